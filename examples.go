@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// generateExamples controls whether an example is rendered for each
+// method, calling it against a server which replays its example
+// response.
+var generateExamples bool
+
+// examplesCode holds the examples rendered so far, until they're
+// written out by RenderExamples.
+var examplesCode bytes.Buffer
+
+const exampleSupportCode = `
+
+// replayExample starts a server which answers every request with the
+// given status, media type and body.
+func replayExample(status int, mediaType, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mediaType != "" {
+			w.Header().Set("Content-Type", mediaType)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+}
+
+// exampleHandler sends requests to server, wherever they're addressed.
+func exampleHandler(server *httptest.Server) RequestHandlerFn {
+	return func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme = "http"
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return server.Client().Do(req)
+	}
+}
+
+// printJSON prints v as indented JSON with its keys sorted, so that what
+// is printed doesn't depend on the order of v's fields.
+func printJSON(v interface{}) {
+	out, err := json.Marshal(v)
+	if err == nil {
+		var sorted interface{}
+		if err = json.Unmarshal(out, &sorted); err == nil {
+			out, err = json.MarshalIndent(sorted, "", "  ")
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(out))
+}`
+
+// RenderExamples renders the examples of the methods rendered by the
+// last call to Render as a test file of the package.
+func RenderExamples(writer io.Writer, packageName string) error {
+	// Only the mapped types the examples refer to need importing.
+	imports := make(map[string]string)
+	for importPath, importName := range usedImports {
+		if regexp.MustCompile(`\b` + importName + `\.`).Match(examplesCode.Bytes()) {
+			imports[importPath] = importName
+		}
+	}
+
+	fmt.Fprintf(writer, "package %s", packageName)
+	renderImports(writer, imports)
+	fmt.Fprint(writer, exampleSupportCode)
+	_, err := writer.Write(examplesCode.Bytes())
+	return err
+}
+
+// renderExample renders an example of calling the method methName with
+// args, against a server which replays the method's example response.
+// invalid is the error Validate returns for args, if any.
+func renderExample(writer io.Writer, method *WadlMethod, methName, args, invalid, responseType string) {
+	const exampleTmpl = `
+
+func Example_{{.FunName}}() {
+	server := replayExample({{.Status}}, {{printf "%q" .MediaType}}, {{.Body}})
+	defer server.Close()
+
+	results, err := {{.FunName}}(context.Background(), exampleHandler(server), {{.Arguments}})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+{{- if eq .ResponseType "RawResponse"}}
+	defer results.Body.Close()
+	fmt.Println(results.StatusCode, results.ContentType)
+{{- else if eq .ResponseType "TextResponse"}}
+	fmt.Println(results.Text)
+{{- else}}
+	printJSON(results)
+{{- end}}
+{{- if .HasOutput}}
+
+	// Output:
+{{- range .Output}}
+	//{{if .}} {{.}}{{end}}
+{{- end}}
+{{- end}}
+}`
+
+	// The first acceptable status is the one replayed.
+	status := 200
+	if len(method.AcceptableStatus) > 0 {
+		if code, err := strconv.Atoi(method.AcceptableStatus[0]); err == nil {
+			status = code
+		}
+	}
+	// The example is of the JSON representation, whichever media type
+	// is asked for first.
+	mediaType := method.ResponseMediaType
+	example := strings.TrimSpace(method.ResultsExample)
+	if example != "" {
+		mediaType = jsonMediaType
+	}
+	body := strconv.Quote(example)
+	if !strings.Contains(example, "`") {
+		body = "`" + example + "`"
+	}
+	output, hasOutput := renderExampleOutput(method, status, mediaType, example, invalid, responseType)
+
+	if err := template.Must(template.New("example").Parse(exampleTmpl)).Execute(writer, struct {
+		FunName      string
+		Status       int
+		MediaType    string
+		Body         string
+		Arguments    string
+		ResponseType string
+		HasOutput    bool
+		Output       []string
+	}{
+		FunName:      methName,
+		Status:       status,
+		MediaType:    mediaType,
+		Body:         body,
+		Arguments:    args,
+		ResponseType: responseType,
+		HasOutput:    hasOutput,
+		Output:       strings.Split(output, "\n"),
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// renderExampleOutput renders what the example of method prints, when
+// that's known before it's run: the error Validate returns for its
+// arguments, invalid, if there is one, or else what the response replayed
+// with status, mediaType and example is printed as. Results decoded from
+// JSON are only predictable when the example is uniform enough for the
+// results type inferred from it to hold all of it.
+func renderExampleOutput(method *WadlMethod, status int, mediaType, example, invalid, responseType string) (string, bool) {
+	if invalid != "" {
+		return invalid, true
+	}
+	// Servers drop the bodies of these responses.
+	if status == 204 || status == 304 || method.Type == "HEAD" {
+		example = ""
+	}
+
+	var output string
+	switch responseType {
+	case "RawResponse":
+		if mediaType == "" {
+			// The server sniffs the media type, and its guess isn't
+			// worth predicting.
+			return "", false
+		}
+		output = fmt.Sprintf("%d %s", status, mediaType)
+	case "TextResponse":
+		output = example
+	default:
+		var decoded interface{}
+		if example == "" || json.Unmarshal([]byte(example), &decoded) != nil || !isUniformJSON(decoded) {
+			return "", false
+		}
+		encoded, err := json.MarshalIndent(decoded, "", "  ")
+		if err != nil {
+			return "", false
+		}
+		output = string(encoded)
+	}
+	// go test strips the trailing spaces of the lines of Output
+	// comments, but not of what's printed.
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimRight(line, " \t\r") != line {
+			return "", false
+		}
+	}
+	return output, true
+}
+
+// isUniformJSON reports whether the items of every array within the
+// decoded JSON value v have the same shape, so that a struct inferred
+// from v holds all of v, and prints as v does.
+func isUniformJSON(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, value := range v {
+			if !isUniformJSON(value) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !isUniformJSON(item) || !haveSameShape(v[0], item) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// haveSameShape reports whether the decoded JSON values a and b would be
+// given the same Go type: objects with the same keys, whose values have
+// the same shapes, arrays whose items all have the same shape, or the
+// same kind of scalar, telling integers from other numbers.
+func haveSameShape(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			if other, ok := b[key]; !ok || !haveSameShape(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			return false
+		}
+		return isUniformJSON(append(a[:len(a):len(a)], b...))
+	case float64:
+		b, ok := b.(float64)
+		return ok && (a == math.Trunc(a)) == (b == math.Trunc(b))
+	}
+	return fmt.Sprintf("%T", a) == fmt.Sprintf("%T", b)
+}
+
+// renderExampleArgs renders the arguments of an example call to method,
+// filling in the params which are required. Params held in a struct are
+// fields of argsType, which is passed by pointer if optionalArgs is set.
+// The error its Validate method returns for them, if any, is returned
+// too.
+func renderExampleArgs(
+	method *WadlMethod,
+	positional []*WadlVariable,
+	structArgs []*WadlVariable,
+	argsType string,
+	optionalArgs bool,
+) (string, string) {
+	var args []string
+	for _, param := range positional {
+		goType := renderType(param.Type)
+		// Positional arguments aren't validated.
+		value, _ := renderExampleValue(param, goType, "\t")
+		if value == "" {
+			value = fmt.Sprintf("*new(%s)", goType)
+		}
+		args = append(args, value)
+	}
+	switch method.RequestMediaType {
+	case multipartMediaType:
+		args = append(args, `UploadPart{FieldName: "file", FileName: "example.txt", Content: strings.NewReader("example")}`)
+	case octetStreamMediaType:
+		args = append(args, `strings.NewReader("example")`)
+	}
+
+	fields, invalid := renderExampleFields(argsType, structArgs, "\t")
+	switch {
+	case !optionalArgs:
+		args = append(args, fmt.Sprintf("%s{%s}", argsType, fields))
+	case fields != "":
+		args = append(args, fmt.Sprintf("&%s{%s}", argsType, fields))
+	case len(structArgs) > 0:
+		args = append(args, "nil")
+	}
+	return strings.Join(args, ", "), invalid
+}
+
+// renderExampleFields renders the fields of a literal of the struct
+// typeName, indented by indent, which fill in the required params.
+// Structs are validated even when they're optional, so those with
+// required fields of their own are filled in too. Fields without a
+// sensible example value are left unset. The first error the literal's
+// Validate method returns, if any, is returned too.
+func renderExampleFields(typeName string, params []*WadlVariable, indent string) (string, string) {
+	var fields bytes.Buffer
+	var invalid string
+	for _, param := range params {
+		goType := renderFieldType(param)
+		value, valueInvalid := renderExampleValue(param, goType, indent+"\t")
+		switch {
+		case invalid != "":
+		case value == "" && param.Required && renderRequiredCheck(goType, "v") != "":
+			invalid = param.Name + " is required"
+		case value != "" && (param.Required || len(param.EmbeddedVar) > 0 && goType == param.GoType):
+			invalid = valueInvalid
+		}
+		if value == "" || !param.Required && value == goType+"{}" {
+			continue
+		}
+		if param.Required || len(param.EmbeddedVar) > 0 && goType == param.GoType {
+			fmt.Fprintf(&fields, "\n%s\t%s: %s,", indent, renderFieldName(typeName, param), value)
+		}
+	}
+	if fields.Len() > 0 {
+		fmt.Fprintf(&fields, "\n%s", indent)
+	}
+	return fields.String(), invalid
+}
+
+// renderExampleValue renders an example value of the given Go type for
+// param: its first option, if it has any, or a value satisfying its
+// constraints, if one can be found. Structs are filled in like the
+// struct of arguments, indented by indent. An empty string is returned
+// for types with no sensible example. The error Validate returns for the
+// value, if any, is returned too.
+func renderExampleValue(param *WadlVariable, goType, indent string) (string, string) {
+	if len(param.Options) > 0 {
+		return renderEnumValues(goType, param.Options[:1]), ""
+	}
+
+	switch {
+	case len(param.EmbeddedVar) > 0 && goType == param.GoType && !strings.HasPrefix(goType, "*"):
+		// Pointers are only rendered for types which refer to
+		// themselves, and filling them in would never end.
+		fields, invalid := renderExampleFields(goType, param.EmbeddedVar, indent)
+		if invalid != "" {
+			invalid = param.Name + ": " + invalid
+		}
+		return fmt.Sprintf("%s{%s}", goType, fields), invalid
+	case goType == "string":
+		// The param's name usually makes a telling example, if its
+		// constraints allow.
+		candidates := []string{param.Name, strings.ToLower(param.Name), "example", "1"}
+		if length := utf8.RuneCountInString(param.Name); param.MinLength != nil && length < *param.MinLength {
+			candidates = append(candidates, param.Name+strings.Repeat("x", *param.MinLength-length))
+		}
+		for _, value := range candidates {
+			if checkExampleString(param, value) == "" {
+				return strconv.Quote(value), ""
+			}
+		}
+		return strconv.Quote(param.Name), checkExampleString(param, param.Name)
+	case goType == "bool":
+		return "true", ""
+	case goType == "time.Time":
+		return "time.Now()", ""
+	case isNumericGoType(goType):
+		value := 1.0
+		switch {
+		case param.Minimum != nil:
+			value = *param.Minimum
+		case param.Maximum != nil && *param.Maximum < value:
+			value = *param.Maximum
+		}
+		if goType == "float32" || goType == "float64" {
+			return strconv.FormatFloat(value, 'g', -1, 64), checkExampleNumber(param, value)
+		}
+		if param.Minimum != nil {
+			value = math.Ceil(value)
+		} else {
+			value = math.Floor(value)
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64), checkExampleNumber(param, value)
+	}
+	return "", ""
+}
+
+// checkExampleString returns the error Validate returns for value as
+// param, if any. Patterns which can't be compiled aren't checked.
+func checkExampleString(param *WadlVariable, value string) string {
+	switch {
+	case param.MinLength != nil && utf8.RuneCountInString(value) < *param.MinLength:
+		return fmt.Sprintf("%s must be at least %d characters", param.Name, *param.MinLength)
+	case param.MaxLength != nil && utf8.RuneCountInString(value) > *param.MaxLength:
+		return fmt.Sprintf("%s must be at most %d characters", param.Name, *param.MaxLength)
+	}
+	if param.Pattern == "" {
+		return ""
+	}
+	if expr, err := regexp.Compile(param.Pattern); err == nil && !expr.MatchString(value) {
+		return fmt.Sprintf("%s must match %s", param.Name, param.Pattern)
+	}
+	return ""
+}
+
+// checkExampleNumber returns the error Validate returns for value as
+// param, if any.
+func checkExampleNumber(param *WadlVariable, value float64) string {
+	switch {
+	case param.Minimum != nil && value < *param.Minimum:
+		return fmt.Sprintf("%s must be at least %s", param.Name, strconv.FormatFloat(*param.Minimum, 'g', -1, 64))
+	case param.Maximum != nil && value > *param.Maximum:
+		return fmt.Sprintf("%s must be at most %s", param.Name, strconv.FormatFloat(*param.Maximum, 'g', -1, 64))
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderExamples(t *testing.T) {
+	generateExamples = true
+	defer func() { generateExamples = false }()
+
+	getLog := parseTestMethod(t, "http://example.com/servers/{id}/log", `
+<method name="GET" id="getServerLog">
+  <request>
+    <param name="id" style="template" type="xsd:string"/>
+  </request>
+  <response status="200">
+    <representation mediaType="text/plain"/>
+  </response>
+</method>`)
+	downloadImage := parseTestMethod(t, "http://example.com/images/{id}/file", `
+<method name="GET" id="downloadImage">
+  <request>
+    <param name="id" style="template" type="xsd:string"/>
+  </request>
+  <response status="200">
+    <representation mediaType="application/octet-stream"/>
+  </response>
+</method>`)
+	createServer := parseTestMethod(t, "http://example.com/servers", `
+<method name="POST" id="createServer">
+  <request>
+    <representation mediaType="application/json"/>
+  </request>
+  <response status="202"/>
+</method>`)
+	// No example value matches the pattern, so the example shows the
+	// error Validate returns.
+	createServer.Arguments = append(createServer.Arguments, &WadlVariable{
+		Name: "flavor", Type: xsdType("string"), RequestType: "plain", Required: true, Pattern: "^[0-9]{3}$",
+	})
+
+	client := renderTestClient(t, RenderMethodWithBulkTypes, getLog, downloadImage, createServer)
+	var examples bytes.Buffer
+	if err := RenderExamples(&examples, "client"); err != nil {
+		t.Fatalf("RenderExamples failed: %v", err)
+	}
+	checkContains(t, examples.String(),
+		"func Example_getServerLog() {",
+		"\t// Output:\n\t//\n}",
+		"func Example_downloadImage() {",
+		"\t// Output:\n\t// 200 application/octet-stream\n}",
+		"func Example_createServer() {",
+		"\t// Output:\n\t// flavor must match ^[0-9]{3}$\n}",
+	)
+
+	// The examples pass, i.e. print what their Output comments say.
+	runGoTool(t, "client", []string{client}, []string{examples.String()}, "test", ".")
+}
+
+func TestIsUniformJSON(t *testing.T) {
+	tests := []struct {
+		example string
+		want    bool
+	}{
+		{`{"name": "web", "ports": [80, 443]}`, true},
+		{`[{"id": 1, "tags": ["a"]}, {"id": 2, "tags": []}]`, true},
+		{`[{"id": 1, "tags": [[1], ["a"]]}]`, false},
+		// Structs inferred from the first item lack the keys of others.
+		{`[{"id": 1}, {"id": 2, "name": "db"}]`, false},
+		{`[{"id": 1}, {"id": "2"}]`, false},
+		// Integers and other numbers are given different types.
+		{`[1, 2.5]`, false},
+		{`{"servers": [{"addresses": {"private": ["10.0.0.1"]}}, {"addresses": {"private": [null]}}]}`, false},
+	}
+	for _, test := range tests {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(test.example), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if got := isUniformJSON(decoded); got != test.want {
+			t.Errorf("isUniformJSON(%s) = %v, want %v", test.example, got, test.want)
+		}
+	}
+}
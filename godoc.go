@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// docWidth is the width doc comments are wrapped at, including the
+// comment marker.
+var docWidth = 80
+
+type docBlockKind int
+
+const (
+	docParagraph docBlockKind = iota
+	docHeading
+	docListItem
+	docCode
+)
+
+// docBlock is a paragraph, heading, list item or code block of a doc
+// comment.
+type docBlock struct {
+	kind docBlockKind
+	// marker is the bullet or number of list items.
+	marker string
+	// list tells the lists list items belong to apart.
+	list int
+	text string
+}
+
+// docLink is a link to be rendered as a Go doc link definition.
+type docLink struct {
+	text string
+	url  string
+}
+
+// openDocLink is a link element whose text hasn't all been read yet.
+type openDocLink struct {
+	start int
+	url   string
+}
+
+// docConverter converts WADL documentation, which is usually DocBook
+// or XHTML, into the blocks of a Go doc comment.
+type docConverter struct {
+	blocks []docBlock
+	// text is the text of the block being read.
+	text bytes.Buffer
+	// lists holds the next number of each enclosing ordered list, or 0
+	// for bulleted ones.
+	lists []int
+	// listCount is the number of lists started so far.
+	listCount int
+	// item is the marker of the list item being read, if any.
+	item string
+	// heading is whether a title is being read.
+	heading bool
+	// inEntry is whether a variablelist entry, whose term and
+	// definition make up one list item, is being read.
+	inEntry      bool
+	preformatted int
+	openLinks    []openDocLink
+	links        []docLink
+}
+
+// docParagraphElements are the DocBook and XHTML elements which hold a
+// paragraph of their own.
+var docParagraphElements = map[string]bool{
+	"para": true, "simpara": true, "formalpara": true, "p": true,
+	"blockquote": true, "div": true, "section": true,
+	"note": true, "tip": true, "important": true, "warning": true, "caution": true,
+}
+
+// docListElements are the list elements, mapped to 1 for bulleted
+// lists and 2 for numbered ones.
+var docListElements = map[string]int{
+	"itemizedlist": 1, "ul": 1, "simplelist": 1, "variablelist": 1,
+	"orderedlist": 2, "ol": 2,
+}
+
+// docItemElements are the elements of list items.
+var docItemElements = map[string]bool{
+	"listitem": true, "li": true, "member": true,
+}
+
+// docPreformattedElements are the elements of code and other text
+// whose layout matters.
+var docPreformattedElements = map[string]bool{
+	"programlisting": true, "screen": true, "literallayout": true,
+	"pre": true, "synopsis": true,
+}
+
+// docLinkElements are the elements of links.
+var docLinkElements = map[string]bool{
+	"link": true, "ulink": true, "a": true, "olink": true,
+}
+
+// docAutoClose are the HTML elements which are never closed. Unlike
+// xml.HTMLAutoClose, this leaves out link, which DocBook links are
+// written with.
+var docAutoClose = []string{"br", "hr", "img", "input", "meta", "col", "area", "base", "wbr"}
+
+// docAdmonitions are the paragraph elements whose paragraphs are
+// labelled with the kind of admonition they are.
+var docAdmonitions = map[string]string{
+	"note":      "Note: ",
+	"tip":       "Tip: ",
+	"important": "Important: ",
+	"warning":   "Warning: ",
+	"caution":   "Caution: ",
+}
+
+// renderDocumentation renders WADL documentation as a Go doc comment,
+// wrapped at docWidth. DocBook and XHTML paragraphs, lists, program
+// listings and links are rendered as their doc comment equivalents, and
+// any other markup is dropped in favour of its text.
+func renderDocumentation(doc string) string {
+	converter := &docConverter{}
+	if err := converter.convert(doc); err != nil {
+		debug.Printf("documentation isn't well-formed XML, treating it as text: %s", err)
+		converter = &docConverter{}
+		converter.convertText(doc)
+	}
+
+	comment := converter.render()
+	debug.Printf("New doc:\n%s", comment)
+	return comment
+}
+
+func (c *docConverter) convert(doc string) error {
+	decoder := xml.NewDecoder(strings.NewReader("<doc>" + doc + "</doc>"))
+	// Documentation is written by hand, and often with HTML in mind.
+	decoder.Strict = false
+	decoder.AutoClose = docAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			c.text.Write(t)
+		case xml.StartElement:
+			c.startElement(t)
+		case xml.EndElement:
+			c.endElement(t)
+		}
+	}
+	c.flush()
+	return nil
+}
+
+// convertText converts documentation which isn't XML, dropping anything
+// which looks like a tag. Blank lines separate paragraphs.
+func (c *docConverter) convertText(doc string) {
+	doc = regexp.MustCompile(`<[^>]*>`).ReplaceAllString(doc, "")
+	for _, paragraph := range regexp.MustCompile(`\n\s*\n`).Split(doc, -1) {
+		c.text.WriteString(paragraph)
+		c.flush()
+	}
+}
+
+func (c *docConverter) startElement(elem xml.StartElement) {
+	switch name := strings.ToLower(elem.Name.Local); {
+	case docParagraphElements[name]:
+		// Paragraphs within list items are run together, as doc
+		// comment list items are a single paragraph.
+		if c.item == "" && !c.isLabelled() {
+			c.flush()
+			c.text.WriteString(docAdmonitions[name])
+		}
+	case docListElements[name] > 0:
+		c.flush()
+		c.lists = append(c.lists, docListElements[name]-1)
+		c.listCount++
+	case name == "title" && c.item == "":
+		c.flush()
+		c.heading = true
+	case name == "varlistentry":
+		c.beginItem()
+		c.inEntry = true
+	case docItemElements[name] && !c.inEntry:
+		c.beginItem()
+	case docPreformattedElements[name]:
+		c.flush()
+		c.preformatted++
+	case docLinkElements[name]:
+		link := openDocLink{start: c.text.Len()}
+		for _, attr := range elem.Attr {
+			if attr.Name.Local == "href" || attr.Name.Local == "url" {
+				link.url = attr.Value
+			}
+		}
+		c.openLinks = append(c.openLinks, link)
+	case name == "br":
+		c.text.WriteString("\n")
+	}
+}
+
+func (c *docConverter) endElement(elem xml.EndElement) {
+	switch name := strings.ToLower(elem.Name.Local); {
+	case docParagraphElements[name]:
+		if c.item == "" {
+			c.flush()
+		} else {
+			c.text.WriteString(" ")
+		}
+	case docListElements[name] > 0:
+		c.flush()
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+	case name == "title" && c.heading:
+		c.flush()
+	case name == "term" && c.inEntry:
+		c.text.WriteString(": ")
+	case name == "varlistentry":
+		c.flush()
+		c.inEntry = false
+	case docItemElements[name] && !c.inEntry:
+		c.flush()
+	case docPreformattedElements[name]:
+		c.flush()
+		c.preformatted--
+	case docLinkElements[name]:
+		if len(c.openLinks) > 0 {
+			link := c.openLinks[len(c.openLinks)-1]
+			c.openLinks = c.openLinks[:len(c.openLinks)-1]
+			c.closeLink(link)
+		}
+	}
+}
+
+// isLabelled reports whether all that's been read of the block is the
+// label of an admonition, whose paragraph is yet to come.
+func (c *docConverter) isLabelled() bool {
+	text := strings.TrimSpace(c.text.String())
+	for _, label := range docAdmonitions {
+		if text == strings.TrimSpace(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// beginItem starts a list item of the innermost list.
+func (c *docConverter) beginItem() {
+	c.flush()
+	c.item = "-"
+	if depth := len(c.lists); depth > 0 && c.lists[depth-1] > 0 {
+		c.item = fmt.Sprintf("%d.", c.lists[depth-1])
+		c.lists[depth-1]++
+	}
+}
+
+// closeLink replaces the text of link with a doc link to its URL.
+// Links whose text is their URL are left as the URL, which godoc links
+// anyway.
+func (c *docConverter) closeLink(link openDocLink) {
+	if link.url == "" || link.start > c.text.Len() {
+		return
+	}
+	text := strings.Join(strings.Fields(c.text.String()[link.start:]), " ")
+	c.text.Truncate(link.start)
+	if text == "" || text == link.url {
+		c.text.WriteString(link.url)
+		return
+	}
+
+	isDefined := false
+	for _, known := range c.links {
+		if known.text != text {
+			continue
+		}
+		if known.url != link.url {
+			// Doc links are defined by their text, so the same text
+			// can't link to two places.
+			fmt.Fprintf(&c.text, "%s (%s)", text, link.url)
+			return
+		}
+		isDefined = true
+	}
+	if !isDefined {
+		c.links = append(c.links, docLink{text, link.url})
+	}
+	fmt.Fprintf(&c.text, "[%s]", text)
+}
+
+// flush ends the block being read, if it has any text.
+func (c *docConverter) flush() {
+	defer func() {
+		c.text.Reset()
+		c.item = ""
+		c.heading = false
+	}()
+
+	if c.preformatted > 0 {
+		if code := dedentCode(c.text.String()); code != "" {
+			c.blocks = append(c.blocks, docBlock{kind: docCode, text: code})
+		}
+		return
+	}
+
+	text := strings.Join(strings.Fields(c.text.String()), " ")
+	switch {
+	case text == "":
+	case c.heading:
+		c.blocks = append(c.blocks, docBlock{kind: docHeading, text: text})
+	case c.item != "":
+		c.blocks = append(c.blocks, docBlock{kind: docListItem, marker: c.item, list: c.listCount, text: text})
+	default:
+		c.blocks = append(c.blocks, docBlock{kind: docParagraph, text: text})
+	}
+}
+
+// dedentCode trims the blank lines surrounding code, and the
+// indentation common to all its lines.
+func dedentCode(code string) string {
+	lines := strings.Split(strings.Replace(code, "\t", "    ", -1), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lineIndent := len(line) - len(strings.TrimLeft(line, " ")); indent < 0 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			line = line[indent:]
+		}
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// render renders the blocks as a doc comment, followed by the
+// definitions of any links.
+func (c *docConverter) render() string {
+	var lines []string
+	for i, block := range c.blocks {
+		// List items of the same list aren't separated.
+		if i > 0 && !isSameList(c.blocks[i-1], block) {
+			lines = append(lines, "//")
+		}
+
+		switch block.kind {
+		case docParagraph:
+			for _, line := range wrapDocText(block.text, docWidth-len("// ")) {
+				lines = append(lines, "// "+line)
+			}
+		case docHeading:
+			// Headings can't span lines.
+			lines = append(lines, "// # "+block.text)
+		case docListItem:
+			prefix := "//   " + block.marker + " "
+			indent := "//" + strings.Repeat(" ", len(prefix)-len("//"))
+			for j, line := range wrapDocText(block.text, docWidth-len(prefix)) {
+				if j == 0 {
+					lines = append(lines, prefix+line)
+				} else {
+					lines = append(lines, indent+line)
+				}
+			}
+		case docCode:
+			for _, line := range strings.Split(block.text, "\n") {
+				if line == "" {
+					lines = append(lines, "//")
+				} else {
+					lines = append(lines, "//\t"+line)
+				}
+			}
+		}
+	}
+
+	if len(c.links) > 0 && len(lines) > 0 {
+		lines = append(lines, "//")
+		for _, link := range c.links {
+			lines = append(lines, fmt.Sprintf("// [%s]: %s", link.text, link.url))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isSameList(a, b docBlock) bool {
+	return a.kind == docListItem && b.kind == docListItem && a.list == b.list
+}
+
+// wrapDocText wraps text into lines of at most width characters, bar
+// words which are longer by themselves.
+func wrapDocText(text string, width int) []string {
+	var lines []string
+	var line bytes.Buffer
+	for _, word := range strings.Fields(text) {
+		if line.Len() > 0 && utf8Len(line.String())+1+utf8Len(word) > width {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteString(" ")
+		}
+		line.WriteString(word)
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+func utf8Len(s string) int {
+	return len([]rune(s))
+}
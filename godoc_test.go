@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocConverter(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{{
+		name: "paragraphs",
+		doc:  `<para>Lists the servers.</para><para>Only those of the tenant.</para>`,
+		want: "// Lists the servers.\n//\n// Only those of the tenant.",
+	}, {
+		name: "other markup is reduced to its text",
+		doc:  `<p>Returns the <code>id</code> of the <emphasis role="bold">new</emphasis> server.</p>`,
+		want: "// Returns the id of the new server.",
+	}, {
+		name: "entities",
+		doc:  `<p>Servers &amp; images &lt;all&gt; cost &euro;1&nbsp;each.</p>`,
+		want: "// Servers & images <all> cost €1 each.",
+	}, {
+		name: "link",
+		doc:  `<para>See the <link xlink:href="https://example.com/api">API guide</link>.</para>`,
+		want: "// See the [API guide].\n//\n// [API guide]: https://example.com/api",
+	}, {
+		name: "link whose text is its URL",
+		doc:  `<p>See <a href="https://example.com">https://example.com</a>.</p>`,
+		want: "// See https://example.com.",
+	}, {
+		name: "program listing",
+		doc: `<para>For example:</para><programlisting>
+    {
+        "server": {}
+    }
+</programlisting>`,
+		want: "// For example:\n//\n//\t{\n//\t    \"server\": {}\n//\t}",
+	}, {
+		name: "lists",
+		doc:  `<itemizedlist><listitem><para>one</para></listitem><listitem><para>two</para></listitem></itemizedlist><orderedlist><listitem>first</listitem><listitem>second</listitem></orderedlist>`,
+		want: "//   - one\n//   - two\n//\n//   1. first\n//   2. second",
+	}, {
+		name: "title and admonition",
+		doc:  `<section><title>Limits</title><note><para>Requests are throttled.</para></note></section>`,
+		want: "// # Limits\n//\n// Note: Requests are throttled.",
+	}, {
+		name: "format verbs, template actions and backticks",
+		doc:  "<p>Sets 100% of the <code>`quota`</code> with {{.Limit}} and %s%%.</p>",
+		want: "// Sets 100% of the `quota` with {{.Limit}} and %s%%.",
+	}, {
+		name: "wrapped at the doc width",
+		doc:  `<p>` + strings.Repeat("word ", 20) + `</p>`,
+		want: "// word word word word word word word word word word word word word word word\n// word word word word word",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := &docConverter{}
+			if err := converter.convert(test.doc); err != nil {
+				t.Fatalf("convert(%q) failed: %v", test.doc, err)
+			}
+			if got := converter.render(); got != test.want {
+				t.Errorf("convert(%q)\n got %q\nwant %q", test.doc, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWrapDocText(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"", 10, nil},
+		{"a b c", 10, []string{"a b c"}},
+		{"aaa bbb ccc", 7, []string{"aaa bbb", "ccc"}},
+		{"aaa  bbb\nccc", 8, []string{"aaa bbb", "ccc"}},
+		{"averyverylongword a", 5, []string{"averyverylongword", "a"}},
+		{"äää ööö", 7, []string{"äää ööö"}},
+	}
+	for _, test := range tests {
+		if got := wrapDocText(test.text, test.width); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrapDocText(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestDedentCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"", ""},
+		{"\n\n  a\n\n", "a"},
+		{"    a\n      b\n    c", "a\n  b\nc"},
+		{"\ta\n\t\tb", "a\n    b"},
+		{"  a  \n\n  b", "a\n\nb"},
+		{"a\n  b", "a\n  b"},
+	}
+	for _, test := range tests {
+		if got := dedentCode(test.code); got != test.want {
+			t.Errorf("dedentCode(%q) = %q, want %q", test.code, got, test.want)
+		}
+	}
+}
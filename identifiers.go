@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// initialisms are the words which are written in all capitals in
+// identifiers, as golint would have them.
+var initialisms = map[string]bool{
+	"API":  true,
+	"HTTP": true,
+	"ID":   true,
+	"IP":   true,
+	"URL":  true,
+	"UUID": true,
+}
+
+// setInitialisms replaces initialisms with the given comma-separated
+// list.
+func setInitialisms(list string) {
+	initialisms = make(map[string]bool)
+	for _, initialism := range strings.Split(list, ",") {
+		if initialism = strings.TrimSpace(initialism); initialism != "" {
+			initialisms[strings.ToUpper(initialism)] = true
+		}
+	}
+}
+
+// renderIdentifiers renders name as a Go identifier, exported or not.
+// Words are delimited by case changes and by anything which can't
+// appear in an identifier, e.g. server_id, server-id, server.id and
+// serverId are all rendered as ServerID.
+func renderIdentifiers(name string, isPublic bool) string {
+	var identifier bytes.Buffer
+	for i, word := range splitWords(name) {
+		isCapitalized := i > 0 || isPublic
+		switch initialism, ok := renderInitialism(word); {
+		case ok && isCapitalized:
+			identifier.WriteString(initialism)
+		case ok:
+			identifier.WriteString(strings.ToLower(word))
+		default:
+			identifier.WriteString(caseFirstChar(word, isCapitalized))
+		}
+	}
+
+	result := identifier.String()
+	// Identifiers must start with a letter, and exported ones with an
+	// upper-case letter.
+	if r, _ := utf8.DecodeRuneInString(result); !unicode.IsLetter(r) || (isPublic && !unicode.IsUpper(r)) {
+		result = caseFirstChar("x", isPublic) + result
+	}
+	return result
+}
+
+// renderInitialism renders word in capitals if it's one of the
+// initialisms, or the plural of one, e.g. IPs.
+func renderInitialism(word string) (string, bool) {
+	upper := strings.ToUpper(word)
+	if initialisms[upper] {
+		return upper, true
+	}
+	if singular := strings.TrimSuffix(word, "s"); singular != word && initialisms[strings.ToUpper(singular)] {
+		return strings.ToUpper(singular) + "s", true
+	}
+	return "", false
+}
+
+// splitWords splits name into the words which make it up. Anything
+// other than letters and digits separates words, as does an upper-case
+// letter following a lower-case one or a digit, or starting a
+// lower-case word after a run of upper-case letters, as in HTTPServer,
+// unless all that follows is the plural of the run, as in IDs.
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+			continue
+		}
+
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := word[len(word)-1]
+			startsWord := unicode.IsLower(prev) || unicode.IsDigit(prev)
+			if unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !isPluralSuffix(runes[i+1:]) {
+				startsWord = true
+			}
+			if startsWord {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// isPluralSuffix reports whether runes start with an s which ends the
+// word.
+func isPluralSuffix(runes []rune) bool {
+	return runes[0] == 's' && (len(runes) == 1 || !unicode.IsLower(runes[1]))
+}
+
+// goKeywords can't be used as identifiers at all.
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+}
+
+// goPredeclared are Go's predeclared identifiers, and the names of the
+// packages the generated code imports. Declaring them would shadow what
+// the generated code relies on.
+var goPredeclared = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true,
+	"complex128": true, "error": true, "float32": true, "float64": true, "int": true,
+	"int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+	"string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true,
+	"uint64": true, "uintptr": true,
+
+	"true": true, "false": true, "iota": true, "nil": true,
+
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true,
+	"copy": true, "delete": true, "imag": true, "len": true, "make": true,
+	"max": true, "min": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true,
+
+	"base64": true, "bytes": true, "context": true, "errors": true, "fmt": true,
+	"http": true, "io": true, "ioutil": true, "json": true, "log": true,
+	"mime": true, "multipart": true, "regexp": true, "strconv": true,
+	"strings": true, "sync": true, "time": true, "url": true, "xml": true,
+}
+
+// declaredNames are the package-level identifiers declared by the
+// generated code so far, and what declared them.
+var declaredNames = make(map[string]string)
+
+// supportDeclPattern matches the package-level declarations of the
+// generated support code.
+var supportDeclPattern = regexp.MustCompile(`(?m)^(?:func|type|var|const) (\w+)`)
+
+// declareSupportNames declares the identifiers of the generated support
+// code, which no other generated name may take.
+func declareSupportNames(code string) {
+	for _, match := range supportDeclPattern.FindAllStringSubmatch(code, -1) {
+		declaredNames[match[1]] = "the generated support code"
+	}
+	for _, goTypeRef := range resolvedTypeMappings {
+		if _, importPath, importName := parseGoTypeRef(goTypeRef); importPath != "" {
+			declaredNames[importName] = "the imported package " + importPath
+		}
+	}
+}
+
+// declareNames declares the identifiers renderNames renders from base,
+// for what. If any of them is a keyword, is predeclared, or has already
+// been declared, a number is appended to base until none are, and the
+// rename is reported. The base the identifiers were rendered from is
+// returned.
+func declareNames(what, base string, renderNames ...func(string) string) string {
+	candidate := base
+	// The first collision is the one reported.
+	var collidingName, collision string
+	for i := 2; ; i++ {
+		collides := false
+		for _, renderName := range renderNames {
+			name := renderName(candidate)
+			declarer, isDeclared := declaredNames[name]
+			if goKeywords[name] || goPredeclared[name] {
+				declarer, isDeclared = "a Go keyword or predeclared identifier", true
+			}
+			if isDeclared {
+				if collision == "" {
+					collidingName, collision = name, declarer
+				}
+				collides = true
+				break
+			}
+		}
+		if !collides {
+			break
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	if candidate != base {
+		log.Printf("WARNING: renaming %s to %s, as %s collides with %s", what, candidate, collidingName, collision)
+	}
+
+	for _, renderName := range renderNames {
+		declaredNames[renderName(candidate)] = what
+	}
+	return candidate
+}
+
+// renderLocalName renders name as an unexported identifier for use
+// within a function, steering clear of keywords, predeclared
+// identifiers, and the reserved names, by appending suffix.
+func renderLocalName(name, suffix string, reserved map[string]bool) string {
+	name = renderIdentifiers(name, false)
+	for goKeywords[name] || goPredeclared[name] || reserved[name] {
+		name += suffix
+	}
+	return name
+}
+
+// resolveFieldNames gives each of params a field name which is unique
+// within the struct typeName holding them, and doesn't collide with
+// its Validate method, recording them in fieldNames. Names chosen by
+// overrides are given out first, so that it's the generated names
+// which are renamed should they collide.
+func resolveFieldNames(typeName string, params []*WadlVariable) {
+	names := make(map[*WadlVariable]string)
+	taken := map[string]bool{"Validate": true}
+	for _, overridden := range []bool{true, false} {
+		for _, param := range params {
+			base, isOverride := renderOverriddenFieldName(param)
+			if isOverride != overridden {
+				continue
+			}
+			fieldName := base
+			for i := 2; taken[fieldName]; i++ {
+				fieldName = fmt.Sprintf("%s%d", base, i)
+			}
+			if fieldName != base {
+				log.Printf("WARNING: renaming the %s field of %s to %s, as %s is already taken", param.Name, typeName, fieldName, base)
+			}
+			taken[fieldName] = true
+			names[param] = fieldName
+		}
+	}
+	fieldNames[typeName] = names
+}
+
+func renderAsIs(name string) string {
+	return name
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"server", []string{"server"}},
+		{"server_id", []string{"server", "id"}},
+		{"server.id", []string{"server", "id"}},
+		{"server-id", []string{"server", "id"}},
+		{"serverId", []string{"server", "Id"}},
+		{"ServerID", []string{"Server", "ID"}},
+		{"HTTPServer", []string{"HTTP", "Server"}},
+		{"serverIDs", []string{"server", "IDs"}},
+		{"v2Servers", []string{"v2", "Servers"}},
+		{"os-volume_attachments", []string{"os", "volume", "attachments"}},
+		{"__", nil},
+	}
+	for _, test := range tests {
+		if got := splitWords(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRenderIdentifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		isPublic bool
+		want     string
+	}{
+		{"ServerId", true, "ServerID"},
+		{"ServerId", false, "serverID"},
+		{"server.id", true, "ServerID"},
+		{"server_id", true, "ServerID"},
+		{"id", false, "id"},
+		{"id", true, "ID"},
+		{"fixed_ips", true, "FixedIPs"},
+		{"imageUrl", true, "ImageURL"},
+		{"2fa", true, "X2fa"},
+		{"2fa", false, "x2fa"},
+		{"_private", true, "Private"},
+		{"ünïcode", true, "Ünïcode"},
+	}
+	for _, test := range tests {
+		if got := renderIdentifiers(test.name, test.isPublic); got != test.want {
+			t.Errorf("renderIdentifiers(%q, %t) = %q, want %q", test.name, test.isPublic, got, test.want)
+		}
+	}
+}
+
+func TestDeclareNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared map[string]string
+		base     string
+		want     string
+		warning  string
+	}{{
+		name: "free",
+		base: "Server",
+		want: "Server",
+	}, {
+		name:     "taken",
+		declared: map[string]string{"Server": "type server"},
+		base:     "Server",
+		want:     "Server2",
+		warning:  "renaming method server to Server2, as Server collides with type server",
+	}, {
+		name:     "taken with a number",
+		declared: map[string]string{"Server": "type server", "Server2": "method server2"},
+		base:     "Server",
+		want:     "Server3",
+		warning:  "renaming method server to Server3, as Server collides with type server",
+	}, {
+		name:    "keyword",
+		base:    "type",
+		want:    "type2",
+		warning: "renaming method server to type2, as type collides with a Go keyword or predeclared identifier",
+	}}
+	defer log.SetOutput(os.Stderr)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			declaredNames = make(map[string]string)
+			for name, declarer := range test.declared {
+				declaredNames[name] = declarer
+			}
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+
+			if got := declareNames("method server", test.base, renderAsIs); got != test.want {
+				t.Errorf("declareNames(%q) = %q, want %q", test.base, got, test.want)
+			}
+			if test.warning == "" && logged.Len() > 0 {
+				t.Errorf("declareNames(%q) logged %q, want nothing", test.base, logged.String())
+			} else if !strings.Contains(logged.String(), test.warning) {
+				t.Errorf("declareNames(%q) logged %q, want %q", test.base, logged.String(), test.warning)
+			}
+			if declaredNames[test.want] != "method server" {
+				t.Errorf("declareNames(%q) didn't declare %q", test.base, test.want)
+			}
+		})
+	}
+}
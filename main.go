@@ -13,6 +13,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/kat-co/vala"
@@ -23,6 +24,13 @@ var (
 	debug *log.Logger
 )
 
+const (
+	jsonMediaType        = "application/json"
+	formMediaType        = "application/x-www-form-urlencoded"
+	multipartMediaType   = "multipart/form-data"
+	octetStreamMediaType = "application/octet-stream"
+)
+
 type WadlEntryDoc struct {
 	XMLName xml.Name `xml:"application"`
 	wadl.TxsdApplication
@@ -36,6 +44,14 @@ func main() {
 	// TODO(katco-): Set default value to derived value from to-file PWD.
 	packageName := flag.String("package-name", "main", "Specifies the package the generated file will be under.")
 	userBaseUrl := flag.String("base-url", "", "Specifies a replacement for the given base URL.")
+	flag.BoolVar(&generateExamples, "examples", false, "Also write an example of calling each method against a server replaying its example response, in a _example_test.go file beside to-file.")
+	flag.BoolVar(&optionalPointers, "optional-pointers", false, "Render optional scalar fields as pointers, so zero values can be told apart from unset ones.")
+	typeMapFilePath := flag.String("type-map", "", "Specifies a JSON file mapping type QNames to Go types, e.g. {\"csapi:uuid\": \"github.com/google/uuid.UUID\"}.")
+	flag.IntVar(&docWidth, "doc-width", 80, "Specifies the width doc comments are wrapped at.")
+	flag.StringVar(&docLang, "doc-lang", "", "Specifies the language of the documentation to use, e.g. en, when it's in more than one. By default, the first language found is used.")
+	initialismList := flag.String("initialisms", "", "Specifies a comma-separated list of the initialisms written in capitals in identifiers, replacing the default: API,HTTP,ID,IP,URL,UUID.")
+	nameMapFilePath := flag.String("name-map", "", "Specifies a JSON file of the Go names to use for methods, params and types, e.g. {\"methods\": {\"listVolumesDetail_v2\": \"listVolumes\"}}.")
+	methodStyle := flag.String("method-style", "bulk", "Specifies how method arguments are rendered: bulk (a single Params struct) or ordered (positional template params and an Options struct).")
 	flag.Parse()
 
 	var debugBuff io.Writer
@@ -57,11 +73,44 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *initialismList != "" {
+		setInitialisms(*initialismList)
+	}
+
+	var renderMethod func(io.Writer, *WadlMethod) error
+	switch *methodStyle {
+	default:
+		log.Fatalf("unknown method style: %s", *methodStyle)
+	case "bulk":
+		renderMethod = RenderMethodWithBulkTypes
+	case "ordered":
+		renderMethod = RenderMethodWithOrderedArgs
+	}
+
+	if *typeMapFilePath != "" {
+		if err := readTypeMapFile(*typeMapFilePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *nameMapFilePath != "" {
+		if err := readNameOverrideFile(*nameMapFilePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	contents, err := ioutil.ReadFile(*wadlFilePath)
 	if err != nil {
 		panic(err)
 	}
 
+	if contents, err = resolveQNames(contents); err != nil {
+		log.Fatalf("could not resolve type names: %s", err)
+	}
+	if err := resolveTypeMappings(); err != nil {
+		log.Fatal(err)
+	}
+
 	var rawDoc WadlEntryDoc
 	if err := xml.Unmarshal(contents, &rawDoc); err != nil && err != io.EOF {
 		log.Fatal(err)
@@ -91,76 +140,31 @@ func main() {
 				grammarTypes = append(grammarTypes, rawJsonSchemaParamToParam(rawSchema)...)
 			}
 		}
+		// References may be to types in other grammars, so they can
+		// only be resolved once all the grammars have been read.
+		resolveJsonSchemaRefs(grammarTypes, grammarTypes, make(map[*WadlVariable]bool))
 	}
 
-	// Build methods.
+	// Build methods. Those within resources are built as the resources
+	// are walked.
+	buildMethod := func(rawMethod *wadl.TxsdMethod) *WadlMethod {
+		return rawMethodToMethod(rawMethod, grammarTypes, path.Dir(*wadlFilePath))
+	}
 	for _, rawMethod := range rawDoc.Methods {
-		debug.Printf("rawMethod: %s", rawMethod.Id)
-		method := &WadlMethod{
-			Documentation: rawDocsToDoc(rawMethod.Docs),
-			Name:          string(rawMethod.Id),
-			Type:          string(rawMethod.Name),
-		}
-		if rawMethod.Request != nil {
-			debug.Println("request found")
-			method.Arguments = append(method.Arguments, rawParamToVariable(rawMethod.Request.Params)...)
-			for _, rawRep := range rawMethod.Request.Representations {
-				// HACK(katco-): Care about more than JSON representations
-				if string(rawRep.MediaType) != "application/json" {
-					log.Printf("INFO: skipping request representation: %s", rawRep.MediaType)
-					continue
-				}
-
-				// Check for parameters defined in the grammar.
-				// HACK(katco-): We're specifically checking the json:ref attrbite for Openstack.
-				debug.Printf("jsonref: %s", rawRep.JsonRef)
-				if grammarRef := rawRep.JsonRef.String(); grammarRef != "" {
-					// We know that any variables we might be trying
-					// to reference will be at the top-level, and not
-					// embedded.
-					for _, grammarVar := range grammarTypes {
-						if grammarVar.URI != grammarRef {
-							continue
-						}
-
-						method.Arguments = append(method.Arguments, grammarVar)
-					}
-				}
-
-				method.Arguments = append(method.Arguments, rawParamToVariable(rawRep.Params)...)
-			}
-		}
-		for _, rawResponse := range rawMethod.Responses {
-			method.Results = append(method.Results, rawParamToVariable(rawResponse.Params)...)
-			method.AcceptableStatus = append(
-				method.AcceptableStatus,
-				strings.Split(string(rawResponse.Status), " ")...,
-			)
-
-			for _, rawRep := range rawResponse.Representations {
-				// HACK(katco-): Care about more than JSON representations
-				if string(rawRep.MediaType) != "application/json" {
-					log.Printf("INFO: skipping response representation: %s", rawRep.MediaType)
-					continue
-				}
-
-				// HACK(katco-): Don't assume <= 1 doc elements.
-				example, err := dereferenceExampleFile(path.Dir(*wadlFilePath), rawRep.Docs[0].XsdGoPkgCDATA)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				debug.Printf("example: %s", example)
-
-				method.ResultsExample = example
-				method.Results = append(method.Results, rawParamToVariable(rawRep.Params)...)
-				break
-			}
+		if rawMethod.Id == "" {
+			log.Printf("WARNING: skipping %s method without an id, which can't be referenced", rawMethod.Name)
+			continue
 		}
+		method := buildMethod(rawMethod)
 		structuredDoc.Methods[method.Name] = method
 	}
 
+	// The application's documentation, and that of its sets of
+	// resources, documents the generated package.
+	packageDocs := []string{rawDocsToDoc(rawDoc.Docs)}
 	for _, resources := range rawDoc.Resourceses {
+		packageDocs = append(packageDocs, rawDocsToDoc(resources.Docs))
+
 		baseUrl := *userBaseUrl
 		if baseUrl == "" {
 			baseUrl = string(resources.Base)
@@ -171,18 +175,181 @@ func main() {
 			log.Fatalf("could not determine the base URL: %s", err)
 		}
 		debug.Println("base: " + parsedBaseUrl.String())
-		recurseResources(structuredDoc.Methods, *parsedBaseUrl, nil, resources.Resources)
+		recurseResources(structuredDoc.Methods, buildMethod, *parsedBaseUrl, "", nil, resources.Resources)
 	}
 
 	var methods []*WadlMethod
 	for _, m := range structuredDoc.Methods {
 		methods = append(methods, m)
 	}
+	// Render the methods in a stable order, so that the output, and
+	// which of any colliding names gets renamed, is too.
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
 
 	var file bytes.Buffer
-	Render(&file, *packageName, RenderMethodWithBulkTypes, methods...)
+	if err := Render(&file, *packageName, renderMethod, methods...); err != nil {
+		log.Fatalf("could not render: %s", err)
+	}
+	reportStaleOverrides()
 
 	ioutil.WriteFile(*toFile, file.Bytes(), 0640)
+
+	// The package is documented in a file of its own, as is the
+	// convention, unless that's where the client is going. A doc.go
+	// written by hand, or generated from another WADL, is left alone.
+	wadlFileName := filepath.Base(*wadlFilePath)
+	if docFile := filepath.Join(filepath.Dir(*toFile), "doc.go"); docFile != filepath.Clean(*toFile) {
+		existing, err := ioutil.ReadFile(docFile)
+		switch {
+		case err == nil && !bytes.HasPrefix(existing, []byte(renderPackageDocHeader(wadlFileName))):
+			log.Printf("WARNING: not writing %s, as it wasn't generated from %s", docFile, wadlFileName)
+		case err != nil && !os.IsNotExist(err):
+			log.Fatalf("could not read the package documentation: %s", err)
+		default:
+			var doc bytes.Buffer
+			RenderPackageDoc(&doc, *packageName, wadlFileName, packageDocs...)
+			if err := ioutil.WriteFile(docFile, doc.Bytes(), 0640); err != nil {
+				log.Fatalf("could not write the package documentation: %s", err)
+			}
+		}
+	}
+
+	if generateExamples {
+		var examples bytes.Buffer
+		if err := RenderExamples(&examples, *packageName); err != nil {
+			log.Fatalf("could not render the examples: %s", err)
+		}
+		examplesFile := strings.TrimSuffix(*toFile, ".go") + "_example_test.go"
+		if err := ioutil.WriteFile(examplesFile, examples.Bytes(), 0640); err != nil {
+			log.Fatalf("could not write the examples: %s", err)
+		}
+	}
+}
+
+// rawMethodToMethod builds a method from its WADL definition,
+// pulling the types of JSON representations from grammarTypes and
+// examples from files relative to wadlDir.
+func rawMethodToMethod(rawMethod *wadl.TxsdMethod, grammarTypes []*WadlVariable, wadlDir string) *WadlMethod {
+	debug.Printf("rawMethod: %s", rawMethod.Id)
+	method := &WadlMethod{
+		Documentation: rawDocsToDoc(rawMethod.Docs),
+		Name:          string(rawMethod.Id),
+		Type:          string(rawMethod.Name),
+	}
+	if rawMethod.Request != nil {
+		debug.Println("request found")
+		method.Arguments = append(method.Arguments, rawParamToVariable(rawMethod.Request.Params)...)
+		for _, rawRep := range rawMethod.Request.Representations {
+			mediaType := string(rawRep.MediaType)
+			switch {
+			case method.RequestMediaType != "" && method.RequestMediaType != mediaType:
+				log.Printf("INFO: skipping additional request representation: %s", mediaType)
+				continue
+			case mediaType == octetStreamMediaType:
+				method.RequestMediaType = mediaType
+				continue
+			case mediaType == formMediaType, mediaType == multipartMediaType:
+				method.RequestMediaType = mediaType
+				// The WADL spec has form fields declared as
+				// query-style params of the representation, but
+				// they belong in the body.
+				for _, param := range rawParamToVariable(rawRep.Params) {
+					if param.RequestType == "" || param.RequestType == "query" {
+						param.RequestType = "plain"
+					}
+					param.InForm = true
+					method.Arguments = append(method.Arguments, param)
+				}
+				continue
+			case mediaType != jsonMediaType:
+				// HACK(katco-): Care about more than JSON, form, and upload representations
+				log.Printf("INFO: skipping request representation: %s", mediaType)
+				continue
+			}
+			method.RequestMediaType = mediaType
+
+			// Check for parameters defined in the grammar.
+			// HACK(katco-): We're specifically checking the json:ref attrbite for Openstack.
+			debug.Printf("jsonref: %s", rawRep.JsonRef)
+			method.Arguments = append(method.Arguments, grammarVariables(grammarTypes, rawRep.JsonRef.String())...)
+
+			method.Arguments = append(method.Arguments, rawParamToVariable(rawRep.Params)...)
+		}
+	}
+	for _, rawResponse := range rawMethod.Responses {
+		method.Results = append(method.Results, rawParamToVariable(rawResponse.Params)...)
+		method.AcceptableStatus = append(
+			method.AcceptableStatus,
+			strings.Split(string(rawResponse.Status), " ")...,
+		)
+
+		exampleFound := false
+		for _, rawRep := range rawResponse.Representations {
+			mediaType := string(rawRep.MediaType)
+			if !isDecodedMediaType(mediaType) && !isStreamedMediaType(mediaType) && !isTextMediaType(mediaType) {
+				log.Printf("INFO: skipping response representation: %s", mediaType)
+				continue
+			}
+			method.addResponseMediaType(mediaType)
+
+			// HACK(katco-): Only JSON examples are used to infer the results type.
+			if mediaType != jsonMediaType || exampleFound {
+				continue
+			}
+			exampleFound = true
+			// The grammar documents the results, even when an example
+			// is what their type is inferred from.
+			method.Results = append(method.Results, grammarVariables(grammarTypes, rawRep.JsonRef.String())...)
+			method.Results = append(method.Results, rawParamToVariable(rawRep.Params)...)
+
+			// The first example doc is the one used; any others are
+			// likely the same example in another form.
+			for _, rawDoc := range rawRep.Docs {
+				example, ok, err := readDocExample(rawDoc, wadlDir)
+				if err != nil {
+					log.Fatal(err)
+				} else if !ok {
+					continue
+				}
+
+				debug.Printf("example: %s", example)
+				method.ResultsExample = example
+				break
+			}
+		}
+	}
+	method.ResponseMediaType = primaryMediaType(method.ResponseMediaTypes)
+	return method
+}
+
+// isStreamedMediaType reports whether responses of the given media
+// type should be handed to the caller as a stream rather than decoded.
+func isStreamedMediaType(mediaType string) bool {
+	if mediaType == octetStreamMediaType {
+		return true
+	}
+	for _, prefix := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") && !isXmlMediaType(mediaType)
+}
+
+func isXmlMediaType(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// isDecodedMediaType reports whether responses of the given media type
+// are decoded into a results struct.
+func isDecodedMediaType(mediaType string) bool {
+	return mediaType == jsonMediaType || isXmlMediaType(mediaType)
 }
 
 func readJsonSchemaFile(filePath string) (map[string]interface{}, error) {
@@ -203,24 +370,14 @@ func rawJsonSchemaParamToParam(rawParams map[string]interface{}) (params []*Wadl
 
 	// First discover all variables.
 	if properties, ok := rawParams["properties"].(map[string]interface{}); ok {
-		for varName, varAttrs := range properties {
-			newParam := &WadlVariable{Name: varName, RequestType: "plain"}
-
-			for attrName, attr := range varAttrs.(map[string]interface{}) {
-				switch strings.ToLower(attrName) {
-				case "id":
-					newParam.URI = attr.(string)
-				case "type":
-					newParam.Type = attr.(string)
-				case "properties":
-					debug.Printf("JSON SCHEMA: ATTR: %v", varAttrs)
-					newParam.EmbeddedVar = rawJsonSchemaParamToParam(varAttrs.(map[string]interface{}))
-				case "documentation":
-					newParam.Documentation = attr.(string)
-				}
-			}
-
-			params = append(params, newParam)
+		// In a stable order, so that the generated code is too.
+		var varNames []string
+		for varName := range properties {
+			varNames = append(varNames, varName)
+		}
+		sort.Strings(varNames)
+		for _, varName := range varNames {
+			params = append(params, rawJsonSchemaToVariable(varName, properties[varName].(map[string]interface{})))
 		}
 	}
 
@@ -245,6 +402,113 @@ func rawJsonSchemaParamToParam(rawParams map[string]interface{}) (params []*Wadl
 	return params
 }
 
+// rawJsonSchemaToVariable converts the JSON schema of a single
+// property into a variable.
+func rawJsonSchemaToVariable(name string, attrs map[string]interface{}) *WadlVariable {
+	newParam := &WadlVariable{Name: name, RequestType: "plain"}
+
+	for attrName, attr := range attrs {
+		switch strings.ToLower(attrName) {
+		case "id":
+			newParam.URI = attr.(string)
+		case "$ref":
+			newParam.Ref = attr.(string)
+		case "type":
+			newParam.Type = attr.(string)
+		case "properties":
+			debug.Printf("JSON SCHEMA: ATTR: %v", attrs)
+			newParam.EmbeddedVar = rawJsonSchemaParamToParam(attrs)
+		case "items":
+			// Tuple validation, with a schema per position, can't be
+			// expressed with a slice.
+			if itemAttrs, ok := attr.(map[string]interface{}); ok {
+				newParam.Items = rawJsonSchemaToVariable(name, itemAttrs)
+			}
+		case "additionalproperties":
+			// This may also be a bool, which leaves the values untyped.
+			if valueAttrs, ok := attr.(map[string]interface{}); ok {
+				newParam.AdditionalProperties = rawJsonSchemaToVariable(name, valueAttrs)
+			}
+		case "documentation", "description":
+			newParam.Documentation = attr.(string)
+		case "enum":
+			for _, option := range attr.([]interface{}) {
+				newParam.Options = append(newParam.Options, fmt.Sprint(option))
+			}
+		case "minlength":
+			newParam.MinLength = jsonSchemaInt(attr)
+		case "maxlength":
+			newParam.MaxLength = jsonSchemaInt(attr)
+		case "minimum":
+			newParam.Minimum = jsonSchemaFloat(attr)
+		case "maximum":
+			newParam.Maximum = jsonSchemaFloat(attr)
+		case "pattern":
+			newParam.Pattern = attr.(string)
+		}
+	}
+
+	return newParam
+}
+
+// resolveJsonSchemaRefs fills in the variables which reference another
+// grammar type through $ref with the definition of that type. Once a
+// type which refers to itself is resolved its variables form a cycle,
+// so those already visited are skipped.
+func resolveJsonSchemaRefs(vars []*WadlVariable, grammarTypes []*WadlVariable, visited map[*WadlVariable]bool) {
+	for _, v := range vars {
+		if v == nil || visited[v] {
+			continue
+		}
+		visited[v] = true
+		if v.Ref != "" {
+			resolveJsonSchemaRef(v, grammarTypes)
+		}
+		resolveJsonSchemaRefs(v.EmbeddedVar, grammarTypes, visited)
+		resolveJsonSchemaRefs([]*WadlVariable{v.Items, v.AdditionalProperties}, grammarTypes, visited)
+	}
+}
+
+func resolveJsonSchemaRef(v *WadlVariable, grammarTypes []*WadlVariable) {
+	for _, grammarVar := range grammarTypes {
+		if grammarVar.URI == "" || grammarVar.URI != v.Ref {
+			continue
+		}
+		if grammarVar == v {
+			log.Printf("WARNING: %s references itself", v.Ref)
+			return
+		}
+		// Sharing the URI lets the referenced type be generated once.
+		v.URI = grammarVar.URI
+		v.Type = grammarVar.Type
+		v.EmbeddedVar = grammarVar.EmbeddedVar
+		v.Items = grammarVar.Items
+		v.AdditionalProperties = grammarVar.AdditionalProperties
+		v.Ref = ""
+		return
+	}
+	log.Printf("WARNING: unknown JSON schema reference: %s", v.Ref)
+}
+
+func jsonSchemaInt(attr interface{}) *int {
+	f, ok := attr.(float64)
+	if !ok {
+		log.Printf("WARNING: expected a number, got: %v", attr)
+		return nil
+	}
+	i := int(f)
+	return &i
+}
+
+func jsonSchemaFloat(attr interface{}) *float64 {
+	f, ok := attr.(float64)
+	if !ok {
+		log.Printf("WARNING: expected a number, got: %v", attr)
+		return nil
+	}
+	return &f
+}
+
 type WadlDoc struct {
 	Methods map[string]*WadlMethod
 }
@@ -259,6 +523,50 @@ type WadlMethod struct {
 	// TODO(katco-): Track Results element attribute for dereferencing types.
 	ResultsExample   string
 	AcceptableStatus []string
+	// RequestMediaType is the media type of the request body, if any.
+	RequestMediaType string
+	// ResponseMediaType is the media type which determines how the
+	// response body is handled, if any.
+	ResponseMediaType string
+	// ResponseMediaTypes are all the documented response media types.
+	ResponseMediaTypes []string
+	// ResourcePath is the path of the method's resource, relative to
+	// the base URL.
+	ResourcePath string
+	// ResourceDocumentation documents the method's resource.
+	ResourceDocumentation string
+	// GoName is what the identifiers generated for the method are
+	// rendered from, once any collisions have been resolved.
+	GoName string
+}
+
+func (m *WadlMethod) addResponseMediaType(mediaType string) {
+	for _, known := range m.ResponseMediaTypes {
+		if known == mediaType {
+			return
+		}
+	}
+	m.ResponseMediaTypes = append(m.ResponseMediaTypes, mediaType)
+}
+
+// primaryMediaType picks the media type a method's response handling
+// is built around. Media types we can decode take precedence, and of
+// those JSON, which results types are built from.
+func primaryMediaType(mediaTypes []string) string {
+	for _, mediaType := range mediaTypes {
+		if mediaType == jsonMediaType {
+			return mediaType
+		}
+	}
+	for _, mediaType := range mediaTypes {
+		if isDecodedMediaType(mediaType) {
+			return mediaType
+		}
+	}
+	if len(mediaTypes) > 0 {
+		return mediaTypes[0]
+	}
+	return ""
 }
 
 type WadlVariable struct {
@@ -270,73 +578,326 @@ type WadlVariable struct {
 	Required      bool
 	Path          string
 	EmbeddedVar   []*WadlVariable
+	// InForm is whether the variable is a field of a form-urlencoded or
+	// multipart request body.
+	InForm bool
+	// Items is the schema of the elements of array variables.
+	Items *WadlVariable
+	// AdditionalProperties is the schema of the values of dictionary
+	// variables, if they're typed.
+	AdditionalProperties *WadlVariable
+	// Ref is the URI of the grammar type the variable is defined by,
+	// until it has been resolved.
+	Ref string
+	// GoType is the generated Go type of variables whose values are
+	// structured, once it has been rendered.
+	GoType string
+	// Options are the values the variable is restricted to, if any.
+	Options []string
+	// The remaining constraints come from JSON Schema grammars.
+	MinLength *int
+	MaxLength *int
+	Minimum   *float64
+	Maximum   *float64
+	Pattern   string
 }
 
-func dereferenceExampleFile(basePath, innerXml string) (string, error) {
-
-	debug.Printf("inner XML: %s", innerXml)
-
-	type DocElem struct {
-		Href string `xml:"href,attr"`
+// grammarVariables returns the grammar types with the given URI.
+func grammarVariables(grammarTypes []*WadlVariable, grammarRef string) (vars []*WadlVariable) {
+	if grammarRef == "" {
+		return nil
 	}
-	var elem DocElem
-	if err := xml.NewDecoder(strings.NewReader(innerXml)).Decode(&elem); err != nil {
-		return "", err
+	// We know that any variables we might be trying to reference will
+	// be at the top-level, and not embedded.
+	for _, grammarVar := range grammarTypes {
+		if grammarVar.URI == grammarRef {
+			vars = append(vars, grammarVar)
+		}
 	}
+	return vars
+}
 
-	debug.Printf("reading file: %s", elem.Href)
+// readDocExample returns the example doc is made of, if it's an
+// example doc. Examples are either read from the file the doc refers
+// to, relative to basePath, or held inline.
+func readDocExample(doc *wadl.TxsdDoc, basePath string) (string, bool, error) {
+	href, inline, ok := findDocExample(doc)
+	if !ok || href == "" {
+		return inline, ok, nil
+	}
 
-	bytes, err := ioutil.ReadFile(path.Join(basePath, elem.Href))
-	return string(bytes), err
+	debug.Printf("reading file: %s", href)
+	example, err := ioutil.ReadFile(path.Join(basePath, href))
+	return string(example), true, err
+}
+
+// findDocExample reports whether doc is an example doc, i.e. one whose
+// content is an xsdxt:code element, and returns the file the example is
+// in or else the example itself.
+func findDocExample(doc *wadl.TxsdDoc) (href, inline string, ok bool) {
+	debug.Printf("inner XML: %s", doc.XsdGoPkgCDATA)
+
+	decoder := xml.NewDecoder(strings.NewReader(doc.XsdGoPkgCDATA))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", "", false
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) != "" {
+				// Prose.
+				return "", "", false
+			}
+		case xml.StartElement:
+			if !isExampleElement(t) {
+				return "", "", false
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "href" {
+					return attr.Value, "", true
+				}
+			}
+
+			var example bytes.Buffer
+			for depth := 1; depth > 0; {
+				token, err := decoder.Token()
+				if err != nil {
+					return "", "", false
+				}
+				switch t := token.(type) {
+				case xml.CharData:
+					example.Write(t)
+				case xml.StartElement:
+					depth++
+				case xml.EndElement:
+					depth--
+				}
+			}
+			return "", strings.TrimSpace(example.String()), true
+		}
+	}
+}
+
+// isExampleElement reports whether elem is an xsdxt:code element, or
+// any code element referring to a file. The xsdxt prefix is often
+// declared outside the doc, so it's taken for the namespace.
+func isExampleElement(elem xml.StartElement) bool {
+	if elem.Name.Local != "code" {
+		return false
+	}
+	if elem.Name.Space == xsdxtNamespace || elem.Name.Space == "xsdxt" {
+		return true
+	}
+	for _, attr := range elem.Attr {
+		if attr.Name.Local == "href" {
+			return true
+		}
+	}
+	return false
 }
 
 func recurseResources(
 	methods map[string]*WadlMethod,
+	buildMethod func(*wadl.TxsdMethod) *WadlMethod,
 	base url.URL, // Copy so we can modify it freely.
+	resourcePath string,
 	params []*WadlVariable,
 	resources []*wadl.TxsdResource,
 ) {
 	for _, resource := range resources {
 		baseCopy := base
 		baseCopy.Path = filepath.Join(baseCopy.Path, string(resource.Path))
-		params = append(params, rawParamToVariable(resource.Params)...)
+		resourcePathCopy := path.Join(resourcePath, string(resource.Path))
+		// The params of a resource apply to those within it, but not
+		// to its siblings.
+		resourceParams := append(params[:len(params):len(params)], rawParamToVariable(resource.Params)...)
 
-		debug.Printf("url for %s: %s", resource.Id, baseCopy)
+		debug.Printf("url for %s: %s", resource.Id, &baseCopy)
 
-		recurseResources(methods, baseCopy, params, resource.Resources)
+		recurseResources(methods, buildMethod, baseCopy, resourcePathCopy, resourceParams, resource.Resources)
 
 		for _, rawMethod := range resource.Methods {
-			method, ok := methods[string(rawMethod.Href)[1:]]
-			if !ok {
-				log.Printf("WARNING: referenced method %s was not found", rawMethod)
-				continue
+			var method *WadlMethod
+			if rawMethod.Href == "" {
+				// The method is defined here rather than referenced,
+				// and may not have an id to be referenced by.
+				method = buildMethod(rawMethod)
+				if method.Name == "" {
+					method.Name = synthesizeMethodName(method.Type, resourcePathCopy)
+				}
+				method.Name = uniqueMethodName(methods, method.Name)
+				methods[method.Name] = method
+			} else {
+				var ok bool
+				method, ok = methods[strings.TrimPrefix(string(rawMethod.Href), "#")]
+				if !ok {
+					log.Printf("WARNING: referenced method %s was not found", rawMethod.Href)
+					continue
+				}
 			}
-			method.Url = baseCopy.String()
-			method.Arguments = append(method.Arguments, params...)
+			method.Url = urlTemplate(baseCopy)
+			method.ResourcePath = resourcePathCopy
+			method.ResourceDocumentation = rawDocsToDoc(resource.Docs)
+			method.Arguments = append(method.Arguments, resourceParams...)
+		}
+	}
+}
+
+// synthesizeMethodName names a method which has no id after its HTTP
+// verb and resource path, e.g. GET servers/{id}/ips becomes
+// getServerIPs. Path segments followed by a template param are taken to
+// name a collection the param picks from, and so are made singular.
+func synthesizeMethodName(verb, resourcePath string) string {
+	words := []string{strings.ToLower(verb)}
+	segments := strings.Split(resourcePath, "/")
+	for i, segment := range segments {
+		if segment == "" || urlTemplateVarPattern.MatchString(segment) {
+			continue
+		}
+		if i+1 < len(segments) && urlTemplateVarPattern.MatchString(segments[i+1]) {
+			segment = singular(segment)
 		}
+		words = append(words, segment)
+	}
+	return renderIdentifiers(strings.Join(words, "_"), false)
+}
+
+// singular makes the English plural word singular, as far as simple
+// rules allow.
+func singular(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"),
+		strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"),
+		// e.g. statuses and aliases, unlike responses.
+		strings.HasSuffix(word, "uses"), strings.HasSuffix(word, "iases"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+		return word
+	}
+	return strings.TrimSuffix(word, "s")
+}
+
+// uniqueMethodName returns name, or if there's already a method of that
+// name, name with the first number from 2 up which makes it unique.
+func uniqueMethodName(methods map[string]*WadlMethod, name string) string {
+	uniqueName := name
+	for i := 2; methods[uniqueName] != nil; i++ {
+		uniqueName = fmt.Sprintf("%s%d", name, i)
 	}
+	if uniqueName != name {
+		log.Printf("WARNING: renaming method %s to %s, as there's already a method of that name", name, uniqueName)
+	}
+	return uniqueName
+}
+
+// urlTemplate renders u such that any template params in its path, e.g.
+// {server_id}, are left intact while the rest of the path is escaped.
+func urlTemplate(u url.URL) string {
+	var path bytes.Buffer
+	lastIdx := 0
+	for _, loc := range urlTemplateVarPattern.FindAllStringIndex(u.Path, -1) {
+		path.WriteString((&url.URL{Path: u.Path[lastIdx:loc[0]]}).EscapedPath())
+		path.WriteString(u.Path[loc[0]:loc[1]])
+		lastIdx = loc[1]
+	}
+	path.WriteString((&url.URL{Path: u.Path[lastIdx:]}).EscapedPath())
+
+	query := u.RawQuery
+	u.Path, u.RawPath, u.RawQuery = "", "", ""
+	if query != "" {
+		return u.String() + path.String() + "?" + query
+	}
+	return u.String() + path.String()
 }
 
 func rawParamToVariable(params []*wadl.TxsdParam) (vars []*WadlVariable) {
 	for _, rawParam := range params {
+		var options []string
+		for _, rawOption := range rawParam.Options {
+			options = append(options, string(rawOption.Value))
+		}
+		paramType := string(rawParam.Type)
+		if paramType == "" {
+			paramType = "{" + xmlSchemaNamespace + "}string"
+		}
 		vars = append(vars, &WadlVariable{
 			Documentation: rawDocsToDoc(rawParam.Docs),
 			Name:          string(rawParam.Name),
-			Type:          string(rawParam.Type),
-			Required:      bool(rawParam.Required),
-			RequestType:   string(rawParam.Style),
-			Path:          string(rawParam.Path),
+			Type:          paramType,
+			// Every variable of a URL template must be filled in,
+			// whether or not the WADL says it's required.
+			Required:    bool(rawParam.Required) || rawParam.Style == "template",
+			RequestType: string(rawParam.Style),
+			Path:        string(rawParam.Path),
+			Options:     options,
 		})
 	}
 	return vars
 }
 
+// docLang is the language of the documentation used when there's more
+// than one.
+var docLang string
+
+// rawDocsToDoc gathers the prose of docs in docLang, each as a
+// paragraph headed by its title, if it has one. Example docs are left
+// out.
 func rawDocsToDoc(docs []*wadl.TxsdDoc) string {
 	var comment bytes.Buffer
-	for _, d := range docs {
-		debug.Printf("KT: raw doc: %v", d)
-		fmt.Fprintf(&comment, "%s\n", strings.TrimSpace(d.XsdGoPkgCDATA))
+	for _, d := range selectDocLang(docs) {
+		debug.Printf("raw doc: %v", d)
+		if _, _, isExample := findDocExample(d); isExample {
+			continue
+		}
+		if title := strings.TrimSpace(string(d.Title)); title != "" {
+			comment.WriteString("<title>")
+			xml.EscapeText(&comment, []byte(title))
+			comment.WriteString("</title>\n")
+		}
+		// Blank lines separate docs which turn out not to be XML.
+		fmt.Fprintf(&comment, "<para>%s</para>\n\n", strings.TrimSpace(d.XsdGoPkgCDATA))
 	}
 	debug.Println("Documentation: " + strings.TrimSpace(comment.String()))
 	return strings.TrimSpace(comment.String())
 }
+
+// selectDocLang picks the docs in docLang or, if it isn't set, in the
+// language of the first doc which has one. Docs without a language are
+// always picked, and if there are no others in the language, all of
+// the docs are.
+func selectDocLang(docs []*wadl.TxsdDoc) []*wadl.TxsdDoc {
+	lang := docLang
+	for i := 0; lang == "" && i < len(docs); i++ {
+		lang = string(docs[i].Lang)
+	}
+
+	var selected []*wadl.TxsdDoc
+	inLang := false
+	for _, d := range docs {
+		docTag := string(d.Lang)
+		if docTag != "" && isDocLang(docTag, lang) {
+			inLang = true
+		}
+		if docTag == "" || isDocLang(docTag, lang) {
+			selected = append(selected, d)
+		}
+	}
+	if !inLang {
+		return docs
+	}
+	return selected
+}
+
+// isDocLang reports whether the language tag is lang, or a variant of
+// it, e.g. en-US of en.
+func isDocLang(tag, lang string) bool {
+	if strings.EqualFold(tag, lang) {
+		return true
+	}
+	return len(tag) > len(lang) && tag[len(lang)] == '-' && strings.EqualFold(tag[:len(lang)], lang)
+}
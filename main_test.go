@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSynthesizeMethodName(t *testing.T) {
+	tests := []struct {
+		verb         string
+		resourcePath string
+		want         string
+	}{
+		{"GET", "servers", "getServers"},
+		{"GET", "servers/{id}", "getServer"},
+		{"GET", "/servers/{id}/ips", "getServerIPs"},
+		{"DELETE", "servers/{server_id}/ips/{network}", "deleteServerIP"},
+		{"GET", "statuses/{id}", "getStatus"},
+		{"PUT", "aliases/{alias}", "putAlias"},
+		{"GET", "policies/{id}", "getPolicy"},
+		{"POST", "os-volume_attachments", "postOsVolumeAttachments"},
+		{"GET", "{tenant_id}/servers", "getServers"},
+		{"GET", "", "get"},
+	}
+	for _, test := range tests {
+		if got := synthesizeMethodName(test.verb, test.resourcePath); got != test.want {
+			t.Errorf("synthesizeMethodName(%q, %q) = %q, want %q", test.verb, test.resourcePath, got, test.want)
+		}
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"servers", "server"},
+		{"policies", "policy"},
+		{"addresses", "address"},
+		{"boxes", "box"},
+		{"switches", "switch"},
+		{"statuses", "status"},
+		{"aliases", "alias"},
+		{"responses", "response"},
+		{"status", "status"},
+		{"access", "access"},
+		{"data", "data"},
+	}
+	for _, test := range tests {
+		if got := singular(test.word); got != test.want {
+			t.Errorf("singular(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestRawDocsToDoc(t *testing.T) {
+	defer func() { docLang = "" }()
+	methodXML := `
+<method name="GET" id="listServers">
+  <doc title="Listing servers" xml:lang="en-US">Lists the servers.</doc>
+  <doc xml:lang="fr">Liste les serveurs.</doc>
+  <doc>Requires a token.</doc>
+  <doc xml:lang="en"><xsdxt:code xmlns:xsdxt="http://docs.rackspacecloud.com/xsd-ext/v1.0" href="samples/servers.json"/></doc>
+</method>`
+
+	tests := []struct {
+		lang string
+		want string
+	}{{
+		// The first language found is used by default.
+		lang: "",
+		want: "<title>Listing servers</title>\n<para>Lists the servers.</para>\n\n<para>Requires a token.</para>",
+	}, {
+		lang: "fr",
+		want: "<para>Liste les serveurs.</para>\n\n<para>Requires a token.</para>",
+	}, {
+		// Without docs in the language, all of them are used.
+		lang: "de",
+		want: "<title>Listing servers</title>\n<para>Lists the servers.</para>\n\n<para>Liste les serveurs.</para>\n\n<para>Requires a token.</para>",
+	}}
+	for _, test := range tests {
+		docLang = test.lang
+		method := parseTestMethod(t, "http://example.com/servers", methodXML)
+		if method.Documentation != test.want {
+			t.Errorf("the documentation in %q = %q, want %q", test.lang, method.Documentation, test.want)
+		}
+	}
+
+	docLang = ""
+	method := parseTestMethod(t, "http://example.com/servers", methodXML)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	if want := "// # Listing servers\n//\n// Lists the servers.\n//\n// Requires a token.\n"; !strings.Contains(client, want) {
+		t.Errorf("rendered client doesn't contain %q:\n%s", want, client)
+	}
+}
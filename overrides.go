@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nameOverrides are the Go names chosen for methods, params and types
+// in place of those which would be rendered from the WADL.
+var nameOverrides struct {
+	// Methods maps method ids to the names their identifiers are
+	// rendered from, e.g. listVolumes for listVolumesDetail_v2.
+	Methods map[string]string `json:"methods"`
+	// Params maps param names, optionally qualified by the id of the
+	// method they belong to, e.g. listServers.flavor_id, to the names
+	// of the fields holding them.
+	Params map[string]string `json:"params"`
+	// Types maps the URIs of schemas, or the names which would
+	// otherwise be generated for nested types, to type names.
+	Types map[string]string `json:"types"`
+}
+
+// usedOverrides records which of nameOverrides have been applied, so
+// that stale ones can be reported.
+var usedOverrides = make(map[string]bool)
+
+// readNameOverrideFile reads nameOverrides from the given JSON file,
+// e.g.:
+//
+//	{
+//		"methods": {"listVolumesDetail_v2": "listVolumes"},
+//		"params": {"listServers.flavor_id": "Flavor"},
+//		"types": {"http://example.com/schema#server": "Instance"}
+//	}
+func readNameOverrideFile(filePath string) error {
+	body, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, &nameOverrides); err != nil {
+		return fmt.Errorf("could not parse name overrides %s: %v", filePath, err)
+	}
+	for kind, overrides := range map[string]map[string]string{
+		"methods": nameOverrides.Methods,
+		"params":  nameOverrides.Params,
+		"types":   nameOverrides.Types,
+	} {
+		for key, name := range overrides {
+			if !isGoIdentifier(name) {
+				return fmt.Errorf("name override for %s %s: %q is not a Go identifier", kind, key, name)
+			}
+		}
+	}
+	// Unexported fields would be left out of request bodies.
+	for key, name := range nameOverrides.Params {
+		if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+			return fmt.Errorf("name override for params %s: %q is not exported", key, name)
+		}
+	}
+	return nil
+}
+
+// lookupNameOverride returns the name chosen for key among the given
+// kind of overrides, noting that it's been used.
+func lookupNameOverride(kind string, overrides map[string]string, key string) (string, bool) {
+	name, ok := overrides[key]
+	if ok {
+		usedOverrides[kind+" "+key] = true
+	}
+	return name, ok
+}
+
+// reportStaleOverrides warns about the overrides which weren't applied,
+// most likely because what they name is no longer in the WADL.
+func reportStaleOverrides() {
+	var stale []string
+	for kind, overrides := range map[string]map[string]string{
+		"method": nameOverrides.Methods,
+		"param":  nameOverrides.Params,
+		"type":   nameOverrides.Types,
+	} {
+		for key := range overrides {
+			if !usedOverrides[kind+" "+key] {
+				stale = append(stale, kind+" "+key)
+			}
+		}
+	}
+	sort.Strings(stale)
+	for _, override := range stale {
+		log.Printf("WARNING: the name override for %s was not used", override)
+	}
+}
+
+func isGoIdentifier(name string) bool {
+	if name == "" || goKeywords[name] {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resetNameOverrides forgets the name overrides read so far, and which
+// of them have been used.
+func resetNameOverrides() {
+	nameOverrides.Methods, nameOverrides.Params, nameOverrides.Types = nil, nil, nil
+	usedOverrides = make(map[string]bool)
+}
+
+func TestReadNameOverrideFile(t *testing.T) {
+	defer resetNameOverrides()
+
+	tests := []struct {
+		name      string
+		overrides string
+		err       string
+	}{{
+		name:      "valid",
+		overrides: `{"methods": {"listVolumesDetail_v2": "listVolumes"}, "params": {"listServers.flavor_id": "Flavor"}, "types": {"http://example.com/schema#server": "Instance"}}`,
+	}, {
+		name:      "not an identifier",
+		overrides: `{"types": {"http://example.com/schema#server": "an-instance"}}`,
+		err:       `name override for types http://example.com/schema#server: "an-instance" is not a Go identifier`,
+	}, {
+		name:      "keyword",
+		overrides: `{"methods": {"listVolumes": "func"}}`,
+		err:       `name override for methods listVolumes: "func" is not a Go identifier`,
+	}, {
+		name:      "unexported param",
+		overrides: `{"params": {"flavor_id": "flavor"}}`,
+		err:       `name override for params flavor_id: "flavor" is not exported`,
+	}, {
+		name:      "not JSON",
+		overrides: `{"methods": [}`,
+		err:       "could not parse name overrides",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetNameOverrides()
+			filePath := filepath.Join(t.TempDir(), "names.json")
+			if err := ioutil.WriteFile(filePath, []byte(test.overrides), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := readNameOverrideFile(filePath)
+			if test.err == "" && err != nil {
+				t.Errorf("readNameOverrideFile(%q) = %v, want nil", test.overrides, err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("readNameOverrideFile(%q) = %v, want %q", test.overrides, err, test.err)
+			}
+		})
+	}
+}
+
+func TestRenderNameOverrides(t *testing.T) {
+	defer resetNameOverrides()
+	resetNameOverrides()
+	nameOverrides.Methods = map[string]string{"listVolumesDetail_v2": "listVolumes"}
+	nameOverrides.Params = map[string]string{
+		"listVolumesDetail_v2.limit": "PageSize",
+		"sort_key":                   "SortBy",
+		"removed_param":              "Removed",
+	}
+	nameOverrides.Types = map[string]string{
+		"ListVolumesFilterParams":        "VolumeFilter",
+		"http://example.com/schema#gone": "Gone",
+	}
+
+	method := parseTestMethod(t, "http://example.com/volumes/detail", `
+<method name="GET" id="listVolumesDetail_v2">
+  <request>
+    <param name="limit" style="query" type="xsd:int"/>
+    <param name="sort_key" style="query" type="xsd:string"/>
+  </request>
+  <response status="200"/>
+</method>`)
+	method.Arguments = append(method.Arguments, &WadlVariable{
+		Name:        "filter",
+		RequestType: "plain",
+		EmbeddedVar: []*WadlVariable{{Name: "status", RequestType: "plain", Type: xsdType("string")}},
+	})
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		"func listVolumes(",
+		"type ListVolumesParams struct {",
+		"PageSize int",
+		"SortBy string",
+		"type VolumeFilter struct {",
+		"Filter VolumeFilter",
+	)
+
+	// Overrides which name nothing in the WADL are reported.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	reportStaleOverrides()
+	for _, stale := range []string{"param removed_param", "type http://example.com/schema#gone"} {
+		if want := "WARNING: the name override for " + stale + " was not used"; !strings.Contains(logged.String(), want) {
+			t.Errorf("reportStaleOverrides logged %q, want %q", logged.String(), want)
+		}
+	}
+	if n := strings.Count(logged.String(), "WARNING"); n != 2 {
+		t.Errorf("reportStaleOverrides logged %q, want 2 warnings", logged.String())
+	}
+}
@@ -8,65 +8,431 @@ import (
 	"io/ioutil"
 	"log"
 	"os/exec"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
 	"unicode/utf8"
 )
 
-func Render(writer io.Writer, packageName string, renderMethod func(io.Writer, *WadlMethod) error, methods ...*WadlMethod) error {
+var urlTemplateVarPattern = regexp.MustCompile(`{([^}]+)}`)
 
-	fmt.Fprintf(writer, "package %s", packageName)
+// optionalPointers controls whether optional scalar fields are rendered
+// as pointers, so that zero values can be told apart from unset ones.
+var optionalPointers bool
+
+func Render(writer io.Writer, packageName string, renderMethod func(io.Writer, *WadlMethod) error, methods ...*WadlMethod) error {
 
-	// We need a function to make request.
-	fmt.Fprintln(writer, "\n\ntype RequestHandlerFn func(*http.Request) (*http.Response, error)")
+	// We need a function to make request, and a way to wrap it.
+	var support bytes.Buffer
+	support.WriteString(requestHandlerCode)
+	support.WriteString(contentNegotiationCode)
+	if optionalPointers {
+		renderPointerHelpers(&support)
+	}
+	for _, method := range methods {
+		if method.RequestMediaType == multipartMediaType {
+			support.WriteString(multipartCode)
+			break
+		}
+	}
+	for _, method := range methods {
+		if isStreamedMediaType(method.ResponseMediaType) {
+			support.WriteString(rawResponseCode)
+			break
+		}
+	}
 	for _, method := range methods {
-		if err := renderMethod(writer, method); err != nil {
+		if isTextMediaType(method.ResponseMediaType) {
+			support.WriteString(textResponseCode)
+			break
+		}
+	}
+	// The imports aren't known until all the types have been rendered.
+	usedImports = make(map[string]string)
+	sharedTypes = make(map[string]string)
+	fieldNames = make(map[string]map[*WadlVariable]string)
+	renderingSharedTypes = make(map[string]bool)
+	// Every method needs its names before any is rendered, so that
+	// which method gets renamed doesn't depend on the rendering order.
+	declaredNames = make(map[string]string)
+	declareSupportNames(support.String())
+	xmlTags = false
+	for _, method := range methods {
+		for _, mediaType := range method.ResponseMediaTypes {
+			xmlTags = xmlTags || isXmlMediaType(mediaType)
+		}
+	}
+	examplesCode.Reset()
+	if generateExamples {
+		// The examples are in the same package, if not the same file.
+		declareSupportNames(exampleSupportCode)
+	}
+	for _, method := range methods {
+		base := renderIdentifiers(method.Name, false)
+		if name, ok := lookupNameOverride("method", nameOverrides.Methods, method.Name); ok {
+			base = caseFirstChar(name, false)
+		}
+		method.GoName = declareNames(
+			"method "+method.Name,
+			base,
+			renderMethodFuncName,
+			renderMethodParamName,
+			renderMethodOptionsName,
+			renderMethodResultsName,
+			renderMethodBodyName,
+		)
+	}
+	var methodsCode bytes.Buffer
+	for _, method := range methods {
+		if err := renderMethod(&methodsCode, method); err != nil {
 			return err
 		}
 	}
-	return nil
+
+	fmt.Fprintf(writer, "package %s", packageName)
+	renderImports(writer, usedImports)
+	_, err := support.WriteTo(writer)
+	if err != nil {
+		return err
+	}
+	_, err = methodsCode.WriteTo(writer)
+	return err
 }
 
-func RenderMethodWithBulkTypes(writer io.Writer, method *WadlMethod) error {
-	const funBodyTmpl = `
+const requestHandlerCode = `
 
-{{if .Documentation}}{{renderDocumentation .Documentation}}{{end}}
-func {{.FunName}}(request RequestHandlerFn, args {{.ArgType}}) ({{if .ResponseType}}*{{.ResponseType}},{{end}} error) {
+type RequestHandlerFn func(*http.Request) (*http.Response, error)
 
-	argsAsJson, err := json.Marshal(args)
-	if err != nil {
-		return nil, err
+// Middleware wraps a RequestHandlerFn with additional behavior.
+type Middleware func(RequestHandlerFn) RequestHandlerFn
+
+// ChainMiddleware wraps handler with each of the given middlewares. The
+// first middleware is the outermost, and so sees the request first.
+func ChainMiddleware(handler RequestHandlerFn, middlewares ...Middleware) RequestHandlerFn {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
 	}
+	return handler
+}
 
-	url := "{{.Url}}"
-	{{.ReplaceTemplateVarsCode}}
+// AuthTokenMiddleware sets the given header on every request to the
+// value returned by token.
+func AuthTokenMiddleware(header string, token func(context.Context) (string, error)) Middleware {
+	return func(handler RequestHandlerFn) RequestHandlerFn {
+		return func(req *http.Request) (*http.Response, error) {
+			value, err := token(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(header, value)
+			return handler(req)
+		}
+	}
+}
 
-	var req *http.Request
-	if string(argsAsJson) != "{}" {
-		req, err = http.NewRequest("{{.MethodType}}", url, bytes.NewBuffer(argsAsJson))
-		if err != nil {
-			return nil, err
+// LoggingMiddleware logs every request, its resulting status, and how
+// long it took.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(handler RequestHandlerFn) RequestHandlerFn {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := handler(req)
+			if err != nil {
+				logger.Printf("%s %s: %v (%s)", req.Method, req.URL, err, time.Since(start))
+				return resp, err
+			}
+			logger.Printf("%s %s: %s (%s)", req.Method, req.URL, resp.Status, time.Since(start))
+			return resp, err
 		}
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req, err = http.NewRequest("{{.MethodType}}", url, nil)
-		if err != nil {
-			return nil, err
+	}
+}
+
+// RetryMiddleware retries a request up to maxAttempts times while the
+// response status is one of retryableStatus, doubling the delay
+// between attempts starting from backoff.
+func RetryMiddleware(maxAttempts int, backoff time.Duration, retryableStatus ...int) Middleware {
+	return func(handler RequestHandlerFn) RequestHandlerFn {
+		return func(req *http.Request) (*http.Response, error) {
+			delay := backoff
+			for attempt := 1; ; attempt++ {
+				resp, err := handler(req)
+				if err != nil || attempt >= maxAttempts || !isRetryableStatus(resp.StatusCode, retryableStatus) {
+					return resp, err
+				}
+				if req.Body != nil && req.GetBody == nil {
+					// We can't replay the body.
+					return resp, err
+				}
+				resp.Body.Close()
+
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(delay):
+				}
+				delay *= 2
+
+				if req.GetBody != nil {
+					if req.Body, err = req.GetBody(); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+}
+
+func isRetryableStatus(status int, retryableStatus []int) bool {
+	for _, s := range retryableStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitMiddleware allows at most one request per interval through
+// to the wrapped handler, blocking the rest until their turn.
+func RateLimitMiddleware(interval time.Duration) Middleware {
+	var mu sync.Mutex
+	var nextSlot time.Time
+	return func(handler RequestHandlerFn) RequestHandlerFn {
+		return func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			now := time.Now()
+			if nextSlot.Before(now) {
+				nextSlot = now
+			}
+			wait := nextSlot.Sub(now)
+			nextSlot = nextSlot.Add(interval)
+			mu.Unlock()
+
+			if wait > 0 {
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(wait):
+				}
+			}
+			return handler(req)
+		}
+	}
+}`
+
+const contentNegotiationCode = `
+
+type preferredMediaTypeKey struct{}
+
+// WithPreferredMediaType returns a context which asks for responses in
+// the given media type instead of any of the documented ones.
+func WithPreferredMediaType(ctx context.Context, mediaType string) context.Context {
+	return context.WithValue(ctx, preferredMediaTypeKey{}, mediaType)
+}
+
+func acceptHeader(ctx context.Context, documented string) string {
+	if preferred, ok := ctx.Value(preferredMediaTypeKey{}).(string); ok && preferred != "" {
+		return preferred
+	}
+	return documented
+}
+
+// decodeBody decodes body into v according to the response's media
+// type, falling back to JSON.
+func decodeBody(contentType string, body []byte, v interface{}) error {
+	// Responses such as 204s have nothing to decode.
+	if len(body) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		return xml.Unmarshal(body, v)
+	default:
+		return json.Unmarshal(body, v)
+	}
+}`
+
+// pointerHelperTypes are the scalar types renderType can produce, and
+// which optional fields may therefore be pointers to.
+var pointerHelperTypes = []string{
+	"string", "bool", "int", "int8", "int16", "int32", "int64",
+	"uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "time.Time",
+}
+
+func renderPointerHelpers(writer io.Writer) {
+	for _, goType := range pointerHelperTypes {
+		helperName := caseFirstChar(goType[strings.LastIndex(goType, ".")+1:], true)
+		fmt.Fprintf(writer, "\n\n// %s returns a pointer to v, for setting optional fields.\n", helperName)
+		fmt.Fprintf(writer, "func %s(v %s) *%s { return &v }", helperName, goType, goType)
+	}
+}
+
+const multipartCode = `
+
+// UploadPart is a file streamed as one part of a multipart request.
+type UploadPart struct {
+	FieldName string
+	FileName  string
+	Content   io.Reader
+}
+
+func writeMultipartBody(writer *multipart.Writer, fields url.Values, file UploadPart) error {
+	for name, values := range fields {
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	part, err := writer.CreateFormFile(file.FieldName, file.FileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file.Content); err != nil {
+		return err
+	}
+	return writer.Close()
+}`
+
+const rawResponseCode = `
+
+// RawResponse is a response whose body is handed to the caller
+// undecoded. The caller is responsible for closing Body.
+type RawResponse struct {
+	StatusCode    int
+	Header        http.Header
+	ContentType   string
+	ContentLength int64
+	Body          io.ReadCloser
+}`
+
+const textResponseCode = `
+
+// TextResponse is a response whose body is plain text.
+type TextResponse struct {
+	StatusCode  int
+	Header      http.Header
+	ContentType string
+	Text        string
+}`
+
+// RenderMethodWithBulkTypes renders a method which takes all of its
+// arguments in a single Params struct.
+func RenderMethodWithBulkTypes(writer io.Writer, method *WadlMethod) error {
+	return renderMethod(writer, method, false, nil, renderMethodParamName)
+}
+
+// RenderMethodWithOrderedArgs renders a method which takes its
+// template parameters, which are always required, as positional
+// arguments, and all other parameters in an optional Options struct.
+func RenderMethodWithOrderedArgs(writer io.Writer, method *WadlMethod) error {
+	var positional []*WadlVariable
+	for _, param := range method.Arguments {
+		if param.RequestType == "template" {
+			positional = append(positional, param)
 		}
 	}
+	return renderMethod(writer, method, true, positional, renderMethodOptionsName)
+}
+
+func renderMethod(
+	writer io.Writer,
+	method *WadlMethod,
+	optionalArgs bool,
+	positional []*WadlVariable,
+	renderArgTypeName func(string) string,
+) error {
+	const funBodyTmpl = `
 
+{{if .Documentation}}{{renderDocumentation .Documentation}}{{end}}
+func {{.FunName}}(ctx context.Context, request RequestHandlerFn, {{.Arguments}}) ({{if .ResponseType}}*{{.ResponseType}},{{end}} error) {
+	{{.ArgumentsPrelude}}
+	{{.ValidateArgsCode}}
+{{if eq .RequestMediaType "application/x-www-form-urlencoded" "multipart/form-data"}}
+	form := url.Values{}
+	{{.FormBodyCode}}
+{{else if eq .RequestMediaType "application/json"}}
+	argsAsJson, err := json.Marshal({{.JsonBodyCode}})
+	if err != nil {
+		return nil, err
+	}
+{{end}}
+	endpoint := "{{.Url}}"
+	{{.ReplaceTemplateVarsCode}}
+{{if eq .RequestMediaType "application/x-www-form-urlencoded"}}
+	req, err := http.NewRequestWithContext(ctx, "{{.MethodType}}", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+{{else if eq .RequestMediaType "multipart/form-data"}}
+	pipeReader, pipeWriter := io.Pipe()
+	multipartWriter := multipart.NewWriter(pipeWriter)
+	req, err := http.NewRequestWithContext(ctx, "{{.MethodType}}", endpoint, pipeReader)
+	if err != nil {
+		pipeReader.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+	go func() {
+		pipeWriter.CloseWithError(writeMultipartBody(multipartWriter, form, file))
+	}()
+{{else if eq .RequestMediaType "application/octet-stream"}}
+	req, err := http.NewRequestWithContext(ctx, "{{.MethodType}}", endpoint, content)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+{{else if eq .RequestMediaType "application/json"}}
+	req, err := http.NewRequestWithContext(ctx, "{{.MethodType}}", endpoint, bytes.NewReader(argsAsJson))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+{{else}}
+	req, err := http.NewRequestWithContext(ctx, "{{.MethodType}}", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+{{end}}
 	{{if .ReplaceQueryVarsCode}}
 		query := req.URL.Query()
 		{{.ReplaceQueryVarsCode}}
 		req.URL.RawQuery = query.Encode()
 	{{end}}
+	{{if .AcceptMediaTypes}}
+	req.Header.Set("Accept", acceptHeader(ctx, "{{.AcceptMediaTypes}}"))
+	{{end}}
 
 	resp, err := request(req)
 	if err != nil {
 		return nil, err
 	}
+{{if .StreamResponse}}
+	{{if .AcceptableStatusCodesCsv}}
+	switch resp.StatusCode {
+	default:
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("invalid status (%d): %s", resp.StatusCode, body)
+	case {{.AcceptableStatusCodesCsv}}:
+		break;
+	}
+	{{end}}
+
+	return &RawResponse{
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		Body:          resp.Body,
+	}, nil
+{{else}}
+	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -80,32 +446,159 @@ func {{.FunName}}(request RequestHandlerFn, args {{.ArgType}}) ({{if .ResponseTy
 		break;
 	}
 	{{end}}
-
+{{if .TextResponse}}
+	return &TextResponse{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		ContentType: resp.Header.Get("Content-Type"),
+		Text:        string(body),
+	}, nil
+{{else}}
 	var results {{.ResponseType}}
-	json.Unmarshal(body, &results)
-	{{/* TODO(katco-): Don't ignore error here; look at num of items in response collection */}}
+	if err := decodeBody(resp.Header.Get("Content-Type"), body, &results); err != nil {
+		return nil, fmt.Errorf("could not decode the response: %v", err)
+	}
 	return &results, nil
+{{end}}
+{{end}}
 }`
 
-	methName := renderIdentifiers(method.Name, false)
+	methName := method.GoName
+	if methName == "" {
+		methName = renderMethodFuncName(method.Name)
+	}
+	// Names chosen for the params of this method in particular take
+	// precedence over those chosen for params of the same name. The
+	// params may be shared with other methods, so the names are only
+	// kept while this one is rendered.
+	methodFieldNames = make(map[*WadlVariable]string)
+	defer func() { methodFieldNames = make(map[*WadlVariable]string) }()
+	for _, params := range [][]*WadlVariable{method.Arguments, method.Results} {
+		for _, param := range params {
+			if name, ok := lookupNameOverride("param", nameOverrides.Params, method.Name+"."+param.Name); ok {
+				methodFieldNames[param] = name
+			}
+		}
+	}
 	debug.Printf("methName: %s\n", methName)
 
-	RenderParameterType(writer, methName, method.Arguments)
-	returnStruct := exampleToStruct(method.ResultsExample, renderMethodResultsName(methName))
-	if returnStruct != "" {
-		fmt.Fprintf(writer, "\n\n%s\n", returnStruct)
-	} else {
-		// We Always want to return something.
-		RenderResultsType(writer, methName, method.Results)
+	isPositional := make(map[*WadlVariable]bool)
+	for _, param := range positional {
+		isPositional[param] = true
+	}
+	var structArgs []*WadlVariable
+	for _, param := range method.Arguments {
+		if !isPositional[param] {
+			structArgs = append(structArgs, param)
+		}
+	}
+
+	// Positional arguments are referenced directly; everything else is
+	// a field on args.
+	argumentRef := func(param *WadlVariable) string {
+		if isPositional[param] {
+			return renderPositionalName(renderFieldBaseName(param))
+		}
+		return "args." + renderFieldName(renderArgTypeName(methName), param)
+	}
+	formatValue := func(param *WadlVariable) string {
+		goType, ref := renderFieldType(param), argumentRef(param)
+		if strings.HasPrefix(goType, "*") {
+			goType, ref = goType[1:], "(*"+ref+")"
+		}
+		return renderFormatValue(goType, ref)
+	}
+	isSet := func(param *WadlVariable) string {
+		return renderZeroCheck(renderFieldType(param), argumentRef(param), false)
+	}
+
+	// Every variable in the URL template must be filled in by a param.
+	templateParams := make(map[string]bool)
+	for _, param := range method.Arguments {
+		if param.RequestType == "template" {
+			templateParams[param.Name] = true
+		}
+	}
+	for _, match := range urlTemplateVarPattern.FindAllStringSubmatch(method.Url, -1) {
+		if !templateParams[match[1]] {
+			return fmt.Errorf("%s: no template param for {%s} in %s", method.Name, match[1], method.Url)
+		}
+	}
+
+	var arguments bytes.Buffer
+	for _, param := range positional {
+		fmt.Fprintf(&arguments, "%s %s, ", renderPositionalName(renderFieldBaseName(param)), renderType(param.Type))
+	}
+	// Uploads are streamed rather than marshalled from args.
+	switch method.RequestMediaType {
+	case multipartMediaType:
+		fmt.Fprint(&arguments, "file UploadPart, ")
+	case octetStreamMediaType:
+		fmt.Fprint(&arguments, "content io.Reader, ")
+	}
+	var argumentsPrelude, validateArgsCode string
+	if !optionalArgs || len(structArgs) > 0 {
+		// Catch bad arguments before anything is sent.
+		validateArgsCode = "if err := args.Validate(); err != nil {\n\t\treturn nil, err\n\t}"
+	}
+	argsOrigin := "holds the arguments of " + renderMethodOrigin(methName, method) + "."
+	if !optionalArgs {
+		renderVariableCollection(writer, methName, structArgs, renderArgTypeName, true, argsOrigin)
+		fmt.Fprintf(&arguments, "args %s", renderArgTypeName(methName))
+	} else if len(structArgs) > 0 {
+		renderVariableCollection(writer, methName, structArgs, renderArgTypeName, true, argsOrigin)
+		fmt.Fprintf(&arguments, "opts *%s", renderArgTypeName(methName))
+		argumentsPrelude = fmt.Sprintf("var args %s\n\tif opts != nil {\n\t\targs = *opts\n\t}", renderArgTypeName(methName))
+	} else if arguments.Len() > 0 {
+		// Drop the separator trailing the last positional argument.
+		arguments.Truncate(arguments.Len() - len(", "))
+	}
+
+	responseType := renderMethodResultsName(methName)
+	switch {
+	case isStreamedMediaType(method.ResponseMediaType):
+		responseType = "RawResponse"
+	case isTextMediaType(method.ResponseMediaType):
+		responseType = "TextResponse"
+	default:
+		resultsOrigin := "holds the results of " + renderMethodOrigin(methName, method) + "."
+		returnStruct := exampleToStruct(method.ResultsExample, responseType)
+		if returnStruct != "" {
+			// The example only gives the shape of the results; what
+			// they mean comes from the grammar, if anywhere.
+			returnStruct = annotateExampleFields(returnStruct, method.Results)
+			if xmlTags {
+				returnStruct = jsonTagPattern.ReplaceAllString(returnStruct, "`json:\"$1$2\" xml:\"$1$2\"`")
+			}
+			fmt.Fprintf(writer, "\n\n%s\n%s\n", renderTypeDoc(responseType, resultsOrigin+" Its fields are inferred from an example response."), returnStruct)
+		} else {
+			// We Always want to return something.
+			renderVariableCollection(writer, methName, method.Results, renderMethodResultsName, false, resultsOrigin)
+		}
+	}
+
+	if generateExamples {
+		exampleArgs, invalid := renderExampleArgs(method, positional, structArgs, renderArgTypeName(methName), optionalArgs)
+		renderExample(&examplesCode, method, methName, exampleArgs, invalid, responseType)
 	}
 
 	const templateVarReplaceTmpl = `
-url = strings.Replace(url, "%7B<!.Name!>%7D", args.<!renderIdentifiers .Name true!>, -1)`
+endpoint = strings.Replace(endpoint, "{<!.Name!>}", url.PathEscape(<!formatValue .!>), -1)`
 	const queryVarReplaceTmpl = `
-query.Add("{{.Name}}", fmt.Sprintf("%v", args.{{renderIdentifiers .Name true}}))`
+{{if .Required}}query.Add("{{.Name}}", {{formatValue .}})
+{{- else}}{{$isSet := isSet .}}{{if $isSet}}if {{$isSet}} {
+	query.Add("{{.Name}}", {{formatValue .}})
+}{{else}}query.Add("{{.Name}}", {{formatValue .}}){{end}}{{end}}`
+
+	const formVarTmpl = `
+{{if .Required}}form.Add("{{.Name}}", {{formatValue .}})
+{{- else}}{{$isSet := isSet .}}{{if $isSet}}if {{$isSet}} {
+	form.Add("{{.Name}}", {{formatValue .}})
+}{{else}}form.Add("{{.Name}}", {{formatValue .}}){{end}}{{end}}`
 
 	var replaceTemplateVarsCode bytes.Buffer
 	var replaceQueryVarsCode bytes.Buffer
+	var formBodyCode bytes.Buffer
 	var bodyParams []*WadlVariable
 	for _, param := range method.Arguments {
 		debug.Printf("param type: %s", param.RequestType)
@@ -113,7 +606,7 @@ query.Add("{{.Name}}", fmt.Sprintf("%v", args.{{renderIdentifiers .Name true}}))
 		case "template":
 			var codeSnippet bytes.Buffer
 			if err := template.Must(template.New("").Funcs(template.FuncMap{
-				"renderIdentifiers": renderIdentifiers,
+				"formatValue": formatValue,
 			}).Delims("<!", "!>").Parse(templateVarReplaceTmpl)).Execute(&codeSnippet, param); err != nil {
 				panic(err)
 			}
@@ -125,7 +618,8 @@ query.Add("{{.Name}}", fmt.Sprintf("%v", args.{{renderIdentifiers .Name true}}))
 		case "query":
 			var codeSnippet bytes.Buffer
 			if err := template.Must(template.New("").Funcs(template.FuncMap{
-				"renderIdentifiers": renderIdentifiers,
+				"formatValue": formatValue,
+				"isSet":       isSet,
 			}).Parse(queryVarReplaceTmpl)).Execute(&codeSnippet, param); err != nil {
 				panic(err)
 			}
@@ -135,32 +629,79 @@ query.Add("{{.Name}}", fmt.Sprintf("%v", args.{{renderIdentifiers .Name true}}))
 			}
 		case "plain":
 			bodyParams = append(bodyParams, param)
+			if method.RequestMediaType != formMediaType && method.RequestMediaType != multipartMediaType {
+				break
+			}
+
+			if err := template.Must(template.New("").Funcs(template.FuncMap{
+				"formatValue": formatValue,
+				"isSet":       isSet,
+			}).Parse(formVarTmpl)).Execute(&formBodyCode, param); err != nil {
+				panic(err)
+			}
 		}
 	}
 
+	documentation := method.Documentation
+	if method.ResourceDocumentation != "" {
+		documentation += "\n" + method.ResourceDocumentation
+	}
+
+	// Only plain params belong in a JSON body; everything else is
+	// carried by the URL or headers.
+	jsonBody := "struct{}{}"
+	if method.RequestMediaType == jsonMediaType && len(bodyParams) > 0 {
+		bodyTypeName := renderMethodBodyName(methName)
+		renderStruct(writer, bodyTypeName, bodyParams, "is the JSON body sent by "+methName+".")
+
+		var literal bytes.Buffer
+		fmt.Fprintf(&literal, "%s{\n", bodyTypeName)
+		for _, param := range bodyParams {
+			fmt.Fprintf(&literal, "\t\t%s: %s,\n", renderFieldName(bodyTypeName, param), argumentRef(param))
+		}
+		fmt.Fprint(&literal, "\t}")
+		jsonBody = literal.String()
+	}
+
 	var funBody bytes.Buffer
 	if err := template.Must(template.New("").Funcs(template.FuncMap{
 		"renderDocumentation": renderDocumentation,
 	}).Parse(funBodyTmpl)).Execute(&funBody, &struct {
 		Documentation            string
 		FunName                  string
-		ArgType                  string
+		RequestMediaType         string
+		Arguments                string
+		ArgumentsPrelude         string
+		ValidateArgsCode         string
 		ResponseType             string
 		MethodType               string
 		Url                      string
 		ReplaceTemplateVarsCode  string
 		ReplaceQueryVarsCode     string
+		FormBodyCode             string
+		JsonBodyCode             string
 		AcceptableStatusCodesCsv string
+		StreamResponse           bool
+		TextResponse             bool
+		AcceptMediaTypes         string
 	}{
-		method.Documentation,
+		documentation,
 		methName,
-		renderMethodParamName(methName),
-		renderMethodResultsName(methName),
+		method.RequestMediaType,
+		arguments.String(),
+		argumentsPrelude,
+		validateArgsCode,
+		responseType,
 		method.Type,
 		method.Url,
 		replaceTemplateVarsCode.String(),
 		replaceQueryVarsCode.String(),
+		formBodyCode.String(),
+		jsonBody,
 		strings.Join(method.AcceptableStatus, ","),
+		isStreamedMediaType(method.ResponseMediaType),
+		isTextMediaType(method.ResponseMediaType),
+		strings.Join(renderAcceptMediaTypes(method), ", "),
 	}); err != nil {
 		panic(err)
 	}
@@ -170,6 +711,10 @@ query.Add("{{.Name}}", fmt.Sprintf("%v", args.{{renderIdentifiers .Name true}}))
 }
 
 func exampleToStruct(example string, typeName string) string {
+	// There's nothing for gojson to infer a struct from.
+	if example == "" {
+		return ""
+	}
 	cmd := exec.Command("gojson", "-name", typeName)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -203,125 +748,682 @@ func exampleToStruct(example string, typeName string) string {
 }
 
 func RenderParameterType(writer io.Writer, methName string, params []*WadlVariable) {
-	renderVariableCollection(writer, methName, params, renderMethodParamName)
+	renderVariableCollection(writer, methName, params, renderMethodParamName, true, "holds the arguments of "+methName+".")
 }
 
 func RenderResultsType(writer io.Writer, methName string, params []*WadlVariable) {
-	renderVariableCollection(writer, methName, params, renderMethodResultsName)
+	renderVariableCollection(writer, methName, params, renderMethodResultsName, false, "holds the results of "+methName+".")
 }
 
-func renderDocumentation(doc string) string {
-	var docBlock bytes.Buffer
-	r := bufio.NewReader(strings.NewReader(doc))
-	for lineLen := 0; ; {
-		lineBytes, _, err := r.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				break
+// renderAcceptMediaTypes lists the media types method accepts in its
+// responses, starting with the one its results type is built around, so
+// that servers able to send more than one send that.
+func renderAcceptMediaTypes(method *WadlMethod) []string {
+	mediaTypes := []string{method.ResponseMediaType}
+	for _, mediaType := range method.ResponseMediaTypes {
+		if mediaType != method.ResponseMediaType {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	if method.ResponseMediaType == "" {
+		return mediaTypes[1:]
+	}
+	return mediaTypes
+}
+
+// xmlTags controls whether the structs rendered carry xml tags as well
+// as json ones, as they must when any results may be XML.
+var xmlTags bool
+
+// jsonTagPattern matches the json tags of the structs gojson generates,
+// capturing the name and options.
+var jsonTagPattern = regexp.MustCompile("`json:\"([^\",]*)(,[^\"]*)?\"`")
+
+// renderMethodOrigin describes the method methName for the comments of
+// the types generated for it.
+func renderMethodOrigin(methName string, method *WadlMethod) string {
+	if method.ResourcePath == "" {
+		return methName
+	}
+	return fmt.Sprintf("%s, which sends %s requests to %s", methName, method.Type, method.ResourcePath)
+}
+
+// fieldDocPattern matches the lines of the structs gojson generates
+// which end a field, capturing their JSON name. The tags of fields of
+// nested struct types end the line closing the nested struct.
+var fieldDocPattern = regexp.MustCompile("`json:\"([^\",]+)[^`]*`$")
+
+// annotateExampleFields documents the fields of a struct generated by
+// gojson from an example with the documentation of the variables, or
+// the fields of variables, which have the same JSON name.
+func annotateExampleFields(structCode string, vars []*WadlVariable) string {
+	var annotated []string
+	// The lines which open nested structs, where the comments of the
+	// fields holding them belong.
+	var openings []int
+	for _, line := range strings.Split(structCode, "\n") {
+		trimmed := strings.TrimSpace(line)
+		fieldStart := len(annotated)
+		if strings.HasPrefix(trimmed, "}") && len(openings) > 0 {
+			fieldStart = openings[len(openings)-1]
+			openings = openings[:len(openings)-1]
+		}
+		annotated = append(annotated, line)
+		if strings.HasSuffix(trimmed, "{") {
+			openings = append(openings, len(annotated)-1)
+		}
+
+		match := fieldDocPattern.FindStringSubmatch(trimmed)
+		if match == nil {
+			continue
+		}
+		doc := findVariableDoc(vars, match[1], make(map[*WadlVariable]bool))
+		if doc == "" {
+			continue
+		}
+		opening := annotated[fieldStart]
+		indent := opening[:len(opening)-len(strings.TrimLeft(opening, " \t"))]
+		var comment []string
+		for _, docLine := range strings.Split(renderDocumentation(doc), "\n") {
+			comment = append(comment, indent+docLine)
+		}
+		annotated = append(annotated[:fieldStart], append(comment, annotated[fieldStart:]...)...)
+		// The comment shifts the lines of any enclosing structs' fields.
+		for i := range openings {
+			if openings[i] >= fieldStart {
+				openings[i] += len(comment)
 			}
-			log.Fatalf("error reading documentation: %s", err)
 		}
+	}
+	return strings.Join(annotated, "\n")
+}
+
+// findVariableDoc finds the documentation of the variable named name
+// among vars and their fields, searching breadth first. The variables
+// of types which refer to themselves form cycles, so those already
+// visited are skipped.
+func findVariableDoc(vars []*WadlVariable, name string, visited map[*WadlVariable]bool) string {
+	var fields []*WadlVariable
+	for _, v := range vars {
+		if v == nil || visited[v] {
+			continue
+		}
+		visited[v] = true
+		if v.Name == name && v.Documentation != "" {
+			return v.Documentation
+		}
+		fields = append(fields, v.EmbeddedVar...)
+		for _, schema := range []*WadlVariable{v.Items, v.AdditionalProperties} {
+			if schema != nil {
+				fields = append(fields, schema.EmbeddedVar...)
+			}
+		}
+	}
+	if len(fields) <= 0 {
+		return ""
+	}
+	return findVariableDoc(fields, name, visited)
+}
+
+func renderVariableCollection(
+	writer io.Writer,
+	methName string,
+	params []*WadlVariable,
+	renderCollectionName func(string) string,
+	withValidation bool,
+	origin string,
+) {
+	// Create sub-types for variables with embedded objects.
+	for _, p := range params {
+		typeName := renderIdentifiers(methName+caseFirstChar(p.Name, true), true)
+		field := fmt.Sprintf("the %s field of %s", p.Name, renderCollectionName(methName))
+		p.GoType = renderNestedType(writer, typeName, p, renderCollectionName, withValidation, field)
+		// A struct can't hold itself, so a type whose fields refer
+		// back to it does so through a pointer. Slices and maps of it
+		// are fine as they are.
+		if len(p.EmbeddedVar) > 0 && renderingSharedTypes[p.URI] {
+			p.GoType = "*" + p.GoType
+		}
+	}
+
+	renderStruct(writer, renderCollectionName(methName), params, origin)
+	if withValidation {
+		renderValidateMethod(writer, renderCollectionName(methName), params)
+	}
+}
+
+// renderNestedType renders the struct types making up the value of
+// param, whether it's an object itself or an array or dictionary of
+// them, and returns the Go type which references them. An empty string
+// is returned if param's value has no structure of its own.
+func renderNestedType(
+	writer io.Writer,
+	typeName string,
+	param *WadlVariable,
+	renderCollectionName func(string) string,
+	withValidation bool,
+	field string,
+) string {
+	switch {
+	case len(param.EmbeddedVar) > 0 && param.URI != "":
+		return renderSharedType(writer, param)
+	case len(param.EmbeddedVar) > 0:
+		if name, ok := lookupNameOverride("type", nameOverrides.Types, renderCollectionName(typeName)); ok {
+			typeName, renderCollectionName = name, renderAsIs
+		}
+		typeName = declareNames("the type of "+param.Name, typeName, renderCollectionName)
+		renderVariableCollection(writer, typeName, param.EmbeddedVar, renderCollectionName, withValidation, "holds "+field+".")
+		return renderCollectionName(typeName)
+	case param.Items != nil:
+		elemType := renderNestedType(writer, typeName+"Item", param.Items, renderCollectionName, withValidation, "each element of "+field)
+		if elemType == "" {
+			elemType = renderSchemaType(param.Items)
+		}
+		return "[]" + elemType
+	case param.AdditionalProperties != nil:
+		valueType := renderNestedType(writer, typeName+"Value", param.AdditionalProperties, renderCollectionName, withValidation, "each value of "+field)
+		if valueType == "" {
+			valueType = renderSchemaType(param.AdditionalProperties)
+		}
+		return "map[string]" + valueType
+	}
+	return ""
+}
+
+// sharedTypes are the names of the types generated so far for schemas
+// with an identity of their own, keyed by that identity, i.e. the
+// schema's URI. Every variable of such a schema references the one type.
+var sharedTypes = make(map[string]string)
+
+// renderingSharedTypes are the URIs of the shared types whose fields are
+// being rendered. Fields of these types are of types which refer back
+// to them.
+var renderingSharedTypes = make(map[string]bool)
 
-		lineLen += len(lineBytes)
+// renderSharedType renders the type for the schema of param the first
+// time it's needed, and returns its name. Shared types are named after
+// their schema rather than the method they're first used by, and as
+// they may be used by params, always have a Validate method.
+func renderSharedType(writer io.Writer, param *WadlVariable) string {
+	if typeName, ok := sharedTypes[param.URI]; ok {
+		return typeName
+	}
 
-		fmt.Fprintf(&docBlock, " %s", strings.TrimSpace(string(lineBytes)))
+	typeName := declareNames("the schema "+param.URI, renderSharedTypeName(param), renderAsIs)
+	sharedTypes[param.URI] = typeName
+	origin := "is defined by the schema " + param.URI + "."
+	if param.Documentation != "" {
+		origin += " " + param.Documentation
 	}
+	renderingSharedTypes[param.URI] = true
+	renderVariableCollection(writer, typeName, param.EmbeddedVar, renderAsIs, true, origin)
+	delete(renderingSharedTypes, param.URI)
+	return typeName
+}
 
-	// Start scrubbing.
-	line := string(docBlock.String())
-	line = regexp.MustCompile("<para[^>]*>").ReplaceAllString(line, "\n// ")
-	line = regexp.MustCompile("</para>").ReplaceAllString(line, "")
-	line = regexp.MustCompile("<code[^>]*>").ReplaceAllString(line, "")
-	line = regexp.MustCompile("</code>").ReplaceAllString(line, "")
-	line = regexp.MustCompile("<itemizedlist[^>]*>").ReplaceAllString(line, "\n// ")
-	line = regexp.MustCompile("</itemizedlist>").ReplaceAllString(line, ":")
-	line = regexp.MustCompile("<listitem[^>]*>").ReplaceAllString(line, "")
-	line = regexp.MustCompile("</listitem>").ReplaceAllString(line, "")
-	line = regexp.MustCompile("//\\s*$").ReplaceAllString(line, "")
+// renderSharedTypeName names the shared type of param's schema after
+// the last element of its URI, e.g. Server for
+// http://example.com/schema#server, falling back on param's name.
+func renderSharedTypeName(param *WadlVariable) string {
+	if name, ok := lookupNameOverride("type", nameOverrides.Types, param.URI); ok {
+		return name
+	}
 
-	debug.Printf("New doc:\n%s", line) //docBlock.String())
-	return "// " + line                //docBlock.String()
+	name := param.URI
+	if fragmentIdx := strings.LastIndex(name, "#"); fragmentIdx >= 0 {
+		name = name[fragmentIdx+1:]
+	}
+	name = path.Base(strings.TrimSuffix(name, path.Ext(name)))
+	name = strings.Trim(name, "/.")
+	if name == "" {
+		name = param.Name
+	}
+	return renderIdentifiers(name, true)
 }
 
-func renderVariableCollection(writer io.Writer, methName string, params []*WadlVariable, renderCollectionName func(string) string) {
+// renderSchemaType renders the Go type of a JSON schema without
+// structure of its own. Schemas without a type accept any value.
+func renderSchemaType(schema *WadlVariable) string {
+	if schema.Type == "" {
+		return "interface{}"
+	}
+	return renderType(schema.Type)
+}
+
+// renderTypeDoc renders the doc comment of the type typeName, whose
+// origin completes the sentence its name begins.
+func renderTypeDoc(typeName, origin string) string {
+	return renderDocumentation(template.HTMLEscapeString(typeName + " " + origin))
+}
+
+// renderPackageDocHeader renders the comment marking a doc.go file as
+// generated from wadlFileName, and so safe to regenerate.
+func renderPackageDocHeader(wadlFileName string) string {
+	return fmt.Sprintf("// Code generated by wadl2go from %s. DO NOT EDIT.\n", wadlFileName)
+}
+
+// RenderPackageDoc renders a doc.go file documenting the package with
+// the documentation of the application and its resources.
+func RenderPackageDoc(writer io.Writer, packageName, wadlFileName string, docs ...string) {
+	doc := fmt.Sprintf(
+		"<para>Package %s is a client generated from %s.</para>\n",
+		packageName,
+		template.HTMLEscapeString(wadlFileName),
+	)
+	for _, d := range docs {
+		if d != "" {
+			doc += d + "\n"
+		}
+	}
+	// The header is kept apart from the package comment, so as not to
+	// be taken for part of it.
+	fmt.Fprintf(writer, "%s\n%s\npackage %s\n", renderPackageDocHeader(wadlFileName), renderDocumentation(doc), packageName)
+}
+
+// renderStruct renders a struct type for params whose types have
+// already been resolved.
+func renderStruct(writer io.Writer, typeName string, params []*WadlVariable, origin string) {
+	resolveFieldNames(typeName, params)
+
 	const collectionType = `
 
+{{.Doc}}
 type {{.CollectionName}} struct {
 	{{range .Variables}}
-		{{if .Required}}// {{renderIdentifiers .Name true}} is required.{{end}}
+		{{if .Required}}// {{renderFieldName .}} is required.{{end}}
 		{{if .Documentation}}{{renderDocumentation .Documentation}}{{end}}
-		{{renderIdentifiers .Name true}} {{renderType .Type}} ` + "`json:\"{{if eq .RequestType \"plain\"}}{{.Name}}{{if not .Required}},omitempty{{end}}{{else}}-{{end}}\"`" + `
+		{{renderFieldName .}} {{renderFieldType .}} ` + "`json:\"{{template \"tag\" .}}\"{{if $.XmlTags}} xml:\"{{template \"tag\" .}}\"{{end}}`" + `
 	{{end}}
-}`
-
-	// Create sub-types for variables with embedded objects.
-	for _, p := range params {
-		if len(p.EmbeddedVar) <= 0 {
-			continue
-		}
-		typeName := renderIdentifiers(methName+caseFirstChar(p.Name, true), true)
-		renderVariableCollection(writer, typeName, p.EmbeddedVar, renderCollectionName)
-		p.Type = renderCollectionName(typeName)
-	}
+}
+{{- define "tag"}}{{if eq .RequestType "plain"}}{{.Name}}{{if not .Required}},omitempty{{end}}{{else}}-{{end}}{{end}}`
 
 	var typeBody bytes.Buffer
 	if err := template.Must(template.New("collection").Funcs(template.FuncMap{
-		"renderIdentifiers":   renderIdentifiers,
-		"renderType":          renderType,
+		"renderFieldName": func(param *WadlVariable) string {
+			return renderFieldName(typeName, param)
+		},
+		"renderFieldType":     renderFieldType,
 		"renderDocumentation": renderDocumentation,
 	}).Parse(collectionType)).Execute(&typeBody, struct {
 		CollectionName string
+		Doc            string
 		Variables      []*WadlVariable
+		XmlTags        bool
 		FormatName     func(string, bool) string
 	}{
-		CollectionName: renderCollectionName(methName),
+		CollectionName: typeName,
+		Doc:            renderTypeDoc(typeName, origin),
 		Variables:      params,
+		XmlTags:        xmlTags,
 		FormatName:     renderIdentifiers,
 	}); err != nil {
 		panic(err)
 	}
-	fmt.Fprintf(writer, typeBody.String())
+	io.WriteString(writer, typeBody.String())
 }
 
-func renderIdentifiers(name string, isPublic bool) string {
-	for _, camelCaseSentinel := range []string{"_", "-"} {
-		for {
-			sntlIdx := strings.Index(name, camelCaseSentinel)
-			if sntlIdx < 0 {
-				break
+// renderValidateMethod renders a Validate method for the struct type
+// holding params which checks them against their declared constraints.
+func renderValidateMethod(writer io.Writer, typeName string, params []*WadlVariable) {
+	const validateMethod = `
+{{range .Patterns}}
+var {{.Name}} = regexp.MustCompile({{.Expr}})
+{{end}}
+// Validate checks that the fields of {{.TypeName}} satisfy the constraints
+// declared for them.
+func (v {{.TypeName}}) Validate() error {
+	{{range .Checks}}{{.}}
+	{{end}}
+	return nil
+}`
+
+	type pattern struct {
+		Name string
+		Expr string
+	}
+	var patterns []pattern
+	var checks []string
+	for _, param := range params {
+		goType := renderFieldType(param)
+		ref := "v." + renderFieldName(typeName, param)
+
+		if isUnset := renderRequiredCheck(goType, ref); param.Required && isUnset != "" {
+			checks = append(checks, fmt.Sprintf(
+				"if %s {\n\t\treturn errors.New(%q)\n\t}",
+				isUnset, param.Name+" is required",
+			))
+		}
+
+		switch {
+		case len(param.EmbeddedVar) > 0 && strings.HasPrefix(goType, "*"):
+			checks = append(checks, fmt.Sprintf(
+				"if %s != nil {\n\t\tif err := %s.Validate(); err != nil {\n\t\t\treturn fmt.Errorf(\"%s: %%v\", err)\n\t\t}\n\t}",
+				ref, ref, param.Name,
+			))
+			continue
+		case len(param.EmbeddedVar) > 0:
+			checks = append(checks, fmt.Sprintf(
+				"if err := %s.Validate(); err != nil {\n\t\treturn fmt.Errorf(\"%s: %%v\", err)\n\t}",
+				ref, param.Name,
+			))
+			continue
+		case param.Items != nil && len(param.Items.EmbeddedVar) > 0:
+			checks = append(checks, fmt.Sprintf(
+				"for i, item := range %s {\n\t\tif err := item.Validate(); err != nil {\n\t\t\treturn fmt.Errorf(\"%s[%%d]: %%v\", i, err)\n\t\t}\n\t}",
+				ref, param.Name,
+			))
+			continue
+		case param.AdditionalProperties != nil && len(param.AdditionalProperties.EmbeddedVar) > 0:
+			checks = append(checks, fmt.Sprintf(
+				"for key, value := range %s {\n\t\tif err := value.Validate(); err != nil {\n\t\t\treturn fmt.Errorf(\"%s[%%q]: %%v\", key, err)\n\t\t}\n\t}",
+				ref, param.Name,
+			))
+			continue
+		}
+
+		// The remaining constraints only apply to values which have
+		// been given.
+		var constraints []string
+		isSet := renderZeroCheck(goType, ref, false)
+		if strings.HasPrefix(goType, "*") {
+			goType, ref = goType[1:], "*"+ref
+		}
+
+		if values := renderEnumValues(goType, param.Options); values != "" {
+			constraints = append(constraints, fmt.Sprintf(
+				"switch %s {\n\tcase %s:\n\tdefault:\n\t\treturn fmt.Errorf(\"%s must be one of %s, not %%v\", %s)\n\t}",
+				ref, values, param.Name, strings.Replace(values, `"`, `\"`, -1), ref,
+			))
+		}
+		if goType == "string" {
+			if param.MinLength != nil {
+				constraints = append(constraints, fmt.Sprintf(
+					"if utf8.RuneCountInString(%s) < %d {\n\t\treturn errors.New(%q)\n\t}",
+					ref, *param.MinLength, fmt.Sprintf("%s must be at least %d characters", param.Name, *param.MinLength),
+				))
+			}
+			if param.MaxLength != nil {
+				constraints = append(constraints, fmt.Sprintf(
+					"if utf8.RuneCountInString(%s) > %d {\n\t\treturn errors.New(%q)\n\t}",
+					ref, *param.MaxLength, fmt.Sprintf("%s must be at most %d characters", param.Name, *param.MaxLength),
+				))
+			}
+			// JSON Schema patterns are ECMA-262 regular expressions,
+			// some of which Go's can't express. The generated code
+			// mustn't panic on them when the package is loaded.
+			if _, err := regexp.Compile(param.Pattern); param.Pattern != "" && err != nil {
+				log.Printf("WARNING: leaving out the pattern of %s.%s, which Go can't compile: %s", typeName, param.Name, err)
+			} else if param.Pattern != "" {
+				patternName := declareNames(
+					fmt.Sprintf("the pattern of %s.%s", typeName, param.Name),
+					renderIdentifiers(typeName+"_"+param.Name+"_pattern", false),
+					renderAsIs,
+				)
+				patterns = append(patterns, pattern{patternName, strconv.Quote(param.Pattern)})
+				constraints = append(constraints, fmt.Sprintf(
+					"if !%s.MatchString(%s) {\n\t\treturn errors.New(%q)\n\t}",
+					patternName, ref, fmt.Sprintf("%s must match %s", param.Name, param.Pattern),
+				))
 			}
-			name = name[:sntlIdx] + caseFirstChar(name[sntlIdx+1:], true)
 		}
+		if isNumericGoType(goType) {
+			if param.Minimum != nil {
+				minimum := strconv.FormatFloat(*param.Minimum, 'g', -1, 64)
+				constraints = append(constraints, fmt.Sprintf(
+					"if float64(%s) < %s {\n\t\treturn errors.New(%q)\n\t}",
+					ref, minimum, fmt.Sprintf("%s must be at least %s", param.Name, minimum),
+				))
+			}
+			if param.Maximum != nil {
+				maximum := strconv.FormatFloat(*param.Maximum, 'g', -1, 64)
+				constraints = append(constraints, fmt.Sprintf(
+					"if float64(%s) > %s {\n\t\treturn errors.New(%q)\n\t}",
+					ref, maximum, fmt.Sprintf("%s must be at most %s", param.Name, maximum),
+				))
+			}
+		}
+
+		if len(constraints) == 0 {
+			continue
+		}
+		if param.Required || isSet == "" {
+			checks = append(checks, constraints...)
+			continue
+		}
+		checks = append(checks, fmt.Sprintf(
+			"if %s {\n\t%s\n\t}",
+			isSet, strings.Replace(strings.Join(constraints, "\n"), "\n", "\n\t", -1),
+		))
 	}
 
-	return caseFirstChar(name, isPublic)
+	var methodBody bytes.Buffer
+	if err := template.Must(template.New("validate").Parse(validateMethod)).Execute(&methodBody, struct {
+		TypeName string
+		Patterns []pattern
+		Checks   []string
+	}{typeName, patterns, checks}); err != nil {
+		panic(err)
+	}
+	io.WriteString(writer, methodBody.String())
+}
+
+// renderEnumValues renders the options for a value of the given Go type
+// as a list of case expressions, or an empty string if there are none.
+func renderEnumValues(goType string, options []string) string {
+	if len(options) == 0 {
+		return ""
+	}
+
+	var values []string
+	for _, option := range options {
+		switch {
+		case goType == "string":
+			values = append(values, strconv.Quote(option))
+		case goType == "bool", isNumericGoType(goType):
+			values = append(values, option)
+		default:
+			return ""
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+func renderMethodFuncName(methName string) string {
+	return renderIdentifiers(methName, false)
 }
 
 func renderMethodParamName(methName string) string {
 	return renderIdentifiers(fmt.Sprintf("%sParams", methName), true)
 }
 
+func renderMethodBodyName(methName string) string {
+	return renderIdentifiers(fmt.Sprintf("%sRequestBody", methName), true)
+}
+
+func renderMethodOptionsName(methName string) string {
+	return renderIdentifiers(fmt.Sprintf("%sOptions", methName), true)
+}
+
+// localNames are the local variables of generated methods.
+var localNames = map[string]bool{
+	"ctx": true, "request": true, "args": true, "opts": true, "argsAsJson": true,
+	"form": true, "file": true, "content": true, "pipeReader": true,
+	"pipeWriter": true, "multipartWriter": true, "endpoint": true, "req": true,
+	"query": true, "resp": true, "body": true, "results": true, "err": true,
+}
+
+// renderPositionalName renders the name of a positional argument,
+// steering clear of the local variables used in generated methods.
+func renderPositionalName(name string) string {
+	return renderLocalName(name, "Arg", localNames)
+}
+
+// fieldNames are the names of the fields of each struct type rendered
+// so far, by the variables they hold. A variable may be held by more
+// than one struct, e.g. the params of a resource by the args of each
+// of its methods, and be named differently in each.
+var fieldNames = make(map[string]map[*WadlVariable]string)
+
+// methodFieldNames are the field names chosen for the params of the
+// method being rendered in particular.
+var methodFieldNames = make(map[*WadlVariable]string)
+
+// renderFieldName renders the name of the field of the struct typeName
+// holding param.
+func renderFieldName(typeName string, param *WadlVariable) string {
+	if name, ok := fieldNames[typeName][param]; ok {
+		return name
+	}
+	return renderFieldBaseName(param)
+}
+
+// renderFieldBaseName renders the name param's field is given, unless
+// it collides with another in the same struct.
+func renderFieldBaseName(param *WadlVariable) string {
+	name, _ := renderOverriddenFieldName(param)
+	return name
+}
+
+// renderOverriddenFieldName renders the name param's field is given,
+// and whether it was chosen by an override.
+func renderOverriddenFieldName(param *WadlVariable) (string, bool) {
+	if name, ok := methodFieldNames[param]; ok {
+		return name, true
+	}
+	if name, ok := lookupNameOverride("param", nameOverrides.Params, param.Name); ok {
+		return name, true
+	}
+	return renderIdentifiers(param.Name, true), false
+}
+
+// renderFormatValue renders an expression which formats the value of
+// ref, of the given Go type, as a string.
+func renderFormatValue(goType, ref string) string {
+	switch goType {
+	case "string":
+		return ref
+	case "int":
+		return fmt.Sprintf("strconv.Itoa(%s)", ref)
+	case "int8", "int16", "int32", "int64":
+		return fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", ref)
+	case "uint8", "uint16", "uint32", "uint64":
+		return fmt.Sprintf("strconv.FormatUint(uint64(%s), 10)", ref)
+	case "float32":
+		return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'g', -1, 32)", ref)
+	case "float64":
+		return fmt.Sprintf("strconv.FormatFloat(%s, 'g', -1, 64)", ref)
+	case "bool":
+		return fmt.Sprintf("strconv.FormatBool(%s)", ref)
+	case "time.Time":
+		return fmt.Sprintf("%s.Format(time.RFC3339)", ref)
+	case "[]string":
+		// XML Schema lists are whitespace-separated.
+		return fmt.Sprintf(`strings.Join(%s, " ")`, ref)
+	case "[]byte":
+		return fmt.Sprintf("base64.StdEncoding.EncodeToString(%s)", ref)
+	default:
+		return fmt.Sprintf("fmt.Sprint(%s)", ref)
+	}
+}
+
 func renderMethodResultsName(methName string) string {
 	return renderIdentifiers(fmt.Sprintf("%sResults", methName), true)
 }
 
+// renderFieldType renders the Go type of the struct field holding
+// param. Optional query and form flags, optional fields of types with no zero
+// value to check for, such as mapped ones, and all optional scalars when
+// optionalPointers is set, are pointers so that zero values can be told
+// apart from unset ones.
+func renderFieldType(param *WadlVariable) string {
+	goType := param.GoType
+	if goType == "" {
+		goType = renderType(param.Type)
+	}
+	// Template params are always required, and are never left unset.
+	if param.Required || param.RequestType == "template" || len(param.EmbeddedVar) > 0 {
+		return goType
+	}
+	if optionalPointers && isScalarGoType(goType) {
+		return "*" + goType
+	}
+	if (param.RequestType == "query" || param.InForm) && goType == "bool" {
+		return "*" + goType
+	}
+	if goType != "bool" && renderZeroCheck(goType, "v", true) == "" {
+		return "*" + goType
+	}
+	return goType
+}
+
+func isScalarGoType(goType string) bool {
+	return goType == "string" || goType == "bool" || goType == "time.Time" || isNumericGoType(goType)
+}
+
+// renderZeroCheck renders an expression which reports whether ref, of
+// the given Go type, holds its zero value, or not if isZero is false.
+// An empty string is returned for types with no sensible check.
+func renderZeroCheck(goType, ref string, isZero bool) string {
+	op, not := "==", ""
+	if !isZero {
+		op, not = "!=", "!"
+	}
+	switch {
+	case strings.HasPrefix(goType, "*"), goType == "interface{}":
+		return fmt.Sprintf("%s %s nil", ref, op)
+	case strings.HasPrefix(goType, "[]"), strings.HasPrefix(goType, "map["):
+		return fmt.Sprintf("len(%s) %s 0", ref, op)
+	case goType == "string":
+		return fmt.Sprintf(`%s %s ""`, ref, op)
+	case goType == "time.Time":
+		return fmt.Sprintf("%s%s.IsZero()", not, ref)
+	case isNumericGoType(goType):
+		return fmt.Sprintf("%s %s 0", ref, op)
+	}
+	return ""
+}
+
+// renderRequiredCheck renders an expression which reports whether a
+// required ref has been left unset. Numbers and flags can't be told
+// apart from their zero values, so an empty string is returned.
+func renderRequiredCheck(goType, ref string) string {
+	if goType == "bool" || isNumericGoType(goType) {
+		return ""
+	}
+	return renderZeroCheck(goType, ref, true)
+}
+
+func isNumericGoType(goType string) bool {
+	switch goType {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64":
+		return true
+	}
+	return false
+}
+
 func renderType(wadlType string) string {
-	switch strings.ToLower(wadlType) {
-	default:
-		log.Printf("WARNING: unknown WADL type: %s", wadlType)
-		return wadlType
-	case "object", "xsd:dict":
-		// TODO(katco-): Correctly reference the auto-generated structure type.
-		return "interface{}"
-	case "xsd:datetime":
-		return "time.Time"
-	case "string", "xsd:string", "xsd:uuid", "csapi:uuid", "csapi:string":
-		return "string"
-	case "xsd:int", "integer":
-		return "int"
-	case "xsd:boolean", "boolean":
-		return "bool"
+	if goType, ok := lookupTypeMapping(wadlType); ok {
+		return goType
 	}
+
+	namespace, local := splitQName(wadlType)
+	switch namespace {
+	case xmlSchemaNamespace:
+		if goType, ok := xsdBuiltinTypes[strings.ToLower(local)]; ok {
+			return goType
+		}
+	case "", wadlNamespace:
+		// Names without a namespace of their own, typically those from
+		// JSON Schema grammars.
+		if goType, ok := jsonSchemaTypes[strings.ToLower(local)]; ok {
+			return goType
+		}
+	}
+
+	log.Printf("WARNING: unknown WADL type: %s", wadlType)
+	return wadlType
 }
 
 func caseFirstChar(str string, toUpper bool) string {
@@ -0,0 +1,870 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	debug = log.New(ioutil.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// xsdType renders the QName of the XML Schema built-in type local.
+func xsdType(local string) string {
+	return renderQName(xmlSchemaNamespace, local)
+}
+
+// stdlibPackages are the import paths of the packages generated code
+// refers to, by the names it refers to them by. The generated code
+// leaves importing them to goimports.
+var stdlibPackages = map[string]string{
+	"base64":    "encoding/base64",
+	"big":       "math/big",
+	"bytes":     "bytes",
+	"context":   "context",
+	"errors":    "errors",
+	"fmt":       "fmt",
+	"http":      "net/http",
+	"httptest":  "net/http/httptest",
+	"io":        "io",
+	"ioutil":    "io/ioutil",
+	"json":      "encoding/json",
+	"log":       "log",
+	"math":      "math",
+	"mime":      "mime",
+	"multipart": "mime/multipart",
+	"netip":     "net/netip",
+	"regexp":    "regexp",
+	"strconv":   "strconv",
+	"strings":   "strings",
+	"sync":      "sync",
+	"time":      "time",
+	"url":       "net/url",
+	"utf8":      "unicode/utf8",
+	"xml":       "encoding/xml",
+}
+
+// sourceImporter type-checks the standard library packages the
+// generated code imports, once for all the tests.
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// renderTestClient renders a client of methods with renderMethod,
+// failing t if it doesn't type-check.
+func renderTestClient(t *testing.T, renderMethod func(io.Writer, *WadlMethod) error, methods ...*WadlMethod) string {
+	t.Helper()
+	if err := resolveTypeMappings(); err != nil {
+		t.Fatal(err)
+	}
+	var client bytes.Buffer
+	if err := Render(&client, "client", renderMethod, methods...); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	checkCompiles(t, client.String())
+	return client.String()
+}
+
+// checkCompiles fails t unless sources, the files of a package, type-check
+// once the standard library packages they refer to are imported.
+func checkCompiles(t *testing.T, sources ...string) {
+	t.Helper()
+	fset := token.NewFileSet()
+	conf := types.Config{Importer: sourceImporter}
+	if _, err := conf.Check("client", fset, parseGenerated(t, fset, sources...), nil); err != nil {
+		t.Fatalf("generated code doesn't compile: %v\n%s", err, strings.Join(sources, "\n"))
+	}
+}
+
+// runTestProgram runs sources, the files of a package, as a program, and
+// returns what it prints.
+func runTestProgram(t *testing.T, sources ...string) string {
+	t.Helper()
+	return runGoTool(t, "main", sources, nil, "run", ".")
+}
+
+// runGoTool runs the go tool with args on a module holding the package
+// packageName made of sources, and testSources, its test files, and
+// returns what it prints.
+func runGoTool(t *testing.T, packageName string, sources, testSources []string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go tool is needed to run generated code")
+	}
+	checkCompiles(t, append(sources, testSources...)...)
+
+	dir := t.TempDir()
+	fset := token.NewFileSet()
+	for i, file := range parseGenerated(t, fset, append(sources, testSources...)...) {
+		file.Name.Name = packageName
+		var program bytes.Buffer
+		if err := format.Node(&program, fset, file); err != nil {
+			t.Fatal(err)
+		}
+		fileName := "source" + strconv.Itoa(i) + ".go"
+		if i >= len(sources) {
+			fileName = "source" + strconv.Itoa(i) + "_test.go"
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fileName), program.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module program\n\ngo 1.21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running the generated code failed: %v\n%s", err, output)
+	}
+	return string(output)
+}
+
+// parseGenerated parses sources, the files of a generated package, and
+// imports the standard library packages they refer to.
+func parseGenerated(t *testing.T, fset *token.FileSet, sources ...string) []*ast.File {
+	t.Helper()
+	var files []*ast.File
+	for i, source := range sources {
+		file, err := parser.ParseFile(fset, "source"+strconv.Itoa(i)+".go", source, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("generated code doesn't parse: %v\n%s", err, source)
+		}
+
+		imported := make(map[string]bool)
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			imported[path] = true
+		}
+		var specs []ast.Spec
+		ast.Inspect(file, func(node ast.Node) bool {
+			if selector, ok := node.(*ast.SelectorExpr); ok {
+				// Identifiers declared in the file have been
+				// resolved to their objects already.
+				if name, ok := selector.X.(*ast.Ident); ok && name.Obj == nil {
+					if path, ok := stdlibPackages[name.Name]; ok && !imported[path] {
+						imported[path] = true
+						spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+						specs = append(specs, spec)
+						file.Imports = append(file.Imports, spec)
+					}
+				}
+			}
+			return true
+		})
+		if len(specs) > 0 {
+			file.Decls = append([]ast.Decl{&ast.GenDecl{Tok: token.IMPORT, Specs: specs}}, file.Decls...)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// checkContains fails t unless the rendered client contains each of
+// wants.
+func checkContains(t *testing.T, client string, wants ...string) {
+	t.Helper()
+	for _, want := range wants {
+		if !strings.Contains(client, want) {
+			t.Errorf("rendered client doesn't contain %q:\n%s", want, client)
+		}
+	}
+}
+
+// parseTestMethod builds the method defined by methodXML, a WADL method
+// element which may use the xsd prefix, as a method of url.
+func parseTestMethod(t *testing.T, url, methodXML string) *WadlMethod {
+	t.Helper()
+	doc := `<application xmlns="` + wadlNamespace + `" xmlns:xsd="` + xmlSchemaNamespace + `">` + methodXML + `</application>`
+	contents, err := resolveQNames([]byte(doc))
+	if err != nil {
+		t.Fatalf("resolveQNames failed: %v", err)
+	}
+	var rawDoc WadlEntryDoc
+	if err := xml.Unmarshal(contents, &rawDoc); err != nil {
+		t.Fatalf("could not parse %s: %v", doc, err)
+	}
+	if len(rawDoc.Methods) != 1 {
+		t.Fatalf("%d methods parsed from %s, want 1", len(rawDoc.Methods), doc)
+	}
+	method := rawMethodToMethod(rawDoc.Methods[0], nil, ".")
+	method.Url = url
+	return method
+}
+
+func TestRenderDocumentationWithPercent(t *testing.T) {
+	method := &WadlMethod{
+		Name: "getUsage",
+		Type: "GET",
+		Url:  "https://example.com/usage",
+		Arguments: []*WadlVariable{{
+			Name:          "limit",
+			Type:          xsdType("int"),
+			RequestType:   "query",
+			Documentation: "<p>Usage as a % of the limit, which is long enough to be wrapped, and so to be 100% sure that a % at the end of a line is kept.</p>",
+		}},
+	}
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		"// Usage as a % of the limit, which is long enough to be wrapped, and so to be",
+		"// 100% sure that a % at the end of a line is kept.",
+	)
+}
+
+func TestRenderDocumentationVerbatim(t *testing.T) {
+	method := &WadlMethod{
+		Name:          "setQuota",
+		Type:          "PUT",
+		Url:           "https://example.com/quota",
+		Documentation: "<p>Sets 100% of the `quota` with {{.Limit}} and %s%%.</p>",
+		Arguments: []*WadlVariable{{
+			Name:          "limit",
+			Type:          xsdType("int"),
+			RequestType:   "query",
+			Documentation: "<p>The `limit`, e.g. {{50}} for 50%.</p>",
+		}},
+	}
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		"// Sets 100% of the `quota` with {{.Limit}} and %s%%.",
+		"// The `limit`, e.g. {{50}} for 50%.",
+	)
+}
+
+func TestRenderOptionalMappedParam(t *testing.T) {
+	userTypeMappings = map[string]string{"{urn:test}address": "net/netip.Addr"}
+	defer func() { userTypeMappings = make(map[string]string) }()
+
+	method := &WadlMethod{
+		Name: "listServers",
+		Type: "GET",
+		Url:  "https://example.com/servers",
+		Arguments: []*WadlVariable{
+			{Name: "address", Type: "{urn:test}address", RequestType: "query"},
+			{Name: "gateway", Type: "{urn:test}address", RequestType: "query", Required: true},
+		},
+	}
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		"Address *netip.Addr",
+		"if args.Address != nil {\n\tquery.Add(\"address\", fmt.Sprint((*args.Address)))\n}",
+		"Gateway netip.Addr",
+		"query.Add(\"gateway\", fmt.Sprint(args.Gateway))",
+	)
+}
+
+func TestRenderOptionalFormFlag(t *testing.T) {
+	for _, mediaType := range []string{formMediaType, multipartMediaType} {
+		t.Run(mediaType, func(t *testing.T) {
+			method := parseTestMethod(t, "https://example.com/images", `
+<method name="POST" id="createImage">
+  <request>
+    <representation mediaType="`+mediaType+`">
+      <param name="public" style="query" type="xsd:boolean"/>
+      <param name="shared" style="query" type="xsd:boolean" required="true"/>
+    </representation>
+  </request>
+  <response status="201"/>
+</method>`)
+			client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+			checkContains(t, client,
+				"Public *bool",
+				"if args.Public != nil {\n\tform.Add(\"public\", strconv.FormatBool((*args.Public)))\n}",
+				"Shared bool",
+				"form.Add(\"shared\", strconv.FormatBool(args.Shared))",
+			)
+		})
+	}
+}
+
+func TestRenderValidateMethod(t *testing.T) {
+	minLength, maxLength := 2, 8
+	minimum, maximum := 1.0, 100.0
+	method := &WadlMethod{
+		Name: "listServers",
+		Type: "GET",
+		Url:  "https://example.com/servers",
+		Arguments: []*WadlVariable{
+			{Name: "name", Type: xsdType("string"), RequestType: "query", Required: true, MinLength: &minLength, MaxLength: &maxLength},
+			{Name: "flavor", Type: xsdType("string"), RequestType: "query", Pattern: "^[a-z]+$"},
+			{Name: "ip", Type: xsdType("string"), RequestType: "query", Pattern: "^(?!bad).*$"},
+			{Name: "limit", Type: xsdType("int"), RequestType: "query", Minimum: &minimum, Maximum: &maximum},
+			{Name: "status", Type: xsdType("string"), RequestType: "query", Options: []string{"ACTIVE", "ERROR"}},
+		},
+	}
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		"if err := args.Validate(); err != nil",
+		"if v.Name == \"\" {\n\t\treturn errors.New(\"name is required\")",
+		"if utf8.RuneCountInString(v.Name) < 2 {\n\t\treturn errors.New(\"name must be at least 2 characters\")",
+		"if utf8.RuneCountInString(v.Name) > 8 {\n\t\treturn errors.New(\"name must be at most 8 characters\")",
+		"var listServersParamsFlavorPattern = regexp.MustCompile(\"^[a-z]+$\")",
+		"if v.Flavor != \"\" {\n\tif !listServersParamsFlavorPattern.MatchString(v.Flavor) {",
+		"if float64(v.Limit) < 1 {",
+		"if float64(v.Limit) > 100 {",
+		"case \"ACTIVE\", \"ERROR\":",
+	)
+	// Go can't compile the lookahead, so the pattern is left out rather
+	// than panicking when the package is loaded.
+	if strings.Contains(client, "(?!bad)") {
+		t.Errorf("rendered client checks a pattern Go can't compile:\n%s", client)
+	}
+}
+
+func TestRenderMethodTakesContext(t *testing.T) {
+	method := &WadlMethod{
+		Name: "getServer",
+		Type: "GET",
+		Url:  "https://example.com/servers/{id}",
+		Arguments: []*WadlVariable{
+			{Name: "id", Type: xsdType("string"), RequestType: "template", Required: true},
+		},
+	}
+	for name, renderMethod := range map[string]func(io.Writer, *WadlMethod) error{
+		"bulk":    RenderMethodWithBulkTypes,
+		"ordered": RenderMethodWithOrderedArgs,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := renderTestClient(t, renderMethod, method)
+			checkContains(t, client,
+				"func getServer(ctx context.Context, request RequestHandlerFn, ",
+				`req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)`,
+			)
+		})
+	}
+}
+
+func TestRenderMiddleware(t *testing.T) {
+	method := &WadlMethod{
+		Name: "getServer",
+		Type: "GET",
+		Url:  "http://example.com/servers/{id}",
+		Arguments: []*WadlVariable{
+			{Name: "id", Type: xsdType("string"), RequestType: "template", Required: true},
+		},
+	}
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		fmt.Println(attempts, r.URL.Path, r.Header.Get("X-Auth-Token"))
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	toServer := func(handler RequestHandlerFn) RequestHandlerFn {
+		return func(req *http.Request) (*http.Response, error) {
+			req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+			return handler(req)
+		}
+	}
+	token := func(context.Context) (string, error) { return "secret", nil }
+	handler := ChainMiddleware(
+		http.DefaultClient.Do,
+		RetryMiddleware(5, time.Millisecond, http.StatusServiceUnavailable),
+		AuthTokenMiddleware("X-Auth-Token", token),
+		RateLimitMiddleware(time.Millisecond),
+		toServer,
+	)
+	_, err := getServer(context.Background(), handler, GetServerParams{ID: "a b"})
+	fmt.Println(err)
+}`)
+	if want := "1 /servers/a b secret\n2 /servers/a b secret\n3 /servers/a b secret\n<nil>\n"; output != want {
+		t.Errorf("the generated middleware printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderMethodWithOrderedArgs(t *testing.T) {
+	method := parseTestMethod(t, "https://example.com/servers/{server_id}/ips/{ip}", `
+<method name="PUT" id="updateServerIP">
+  <request>
+    <param name="server_id" style="template" type="xsd:int" required="true"/>
+    <param name="ip" style="template" type="xsd:string"/>
+    <param name="verbose" style="query" type="xsd:boolean"/>
+  </request>
+  <response status="204"/>
+</method>`)
+	getMethod := parseTestMethod(t, "https://example.com/servers/{server_id}", `
+<method name="GET" id="getServer">
+  <request>
+    <param name="server_id" style="template" type="xsd:string"/>
+  </request>
+  <response status="200"/>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithOrderedArgs, method, getMethod)
+	checkContains(t, client,
+		// Template params are positional whether or not they're
+		// documented as required.
+		"func updateServerIP(ctx context.Context, request RequestHandlerFn, serverID int, ip string, opts *UpdateServerIPOptions) (",
+		"if opts != nil {",
+		`endpoint = strings.Replace(endpoint, "{ip}", url.PathEscape(ip), -1)`,
+		"func getServer(ctx context.Context, request RequestHandlerFn, serverID string) (",
+	)
+	if strings.Contains(client, "GetServerOptions") {
+		t.Errorf("rendered client has options for a method with none:\n%s", client)
+	}
+}
+
+func TestRenderUploads(t *testing.T) {
+	uploadFile := parseTestMethod(t, "http://example.com/files", `
+<method name="POST" id="uploadFile">
+  <request>
+    <representation mediaType="multipart/form-data">
+      <param name="description" style="query" type="xsd:string" required="true"/>
+    </representation>
+  </request>
+  <response status="201"/>
+</method>`)
+	uploadImage := parseTestMethod(t, "http://example.com/images/{id}", `
+<method name="PUT" id="uploadImage">
+  <request>
+    <param name="id" style="template" type="xsd:string" required="true"/>
+    <representation mediaType="application/octet-stream"/>
+  </request>
+  <response status="204"/>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, uploadFile, uploadImage)
+	checkContains(t, client,
+		"func uploadFile(ctx context.Context, request RequestHandlerFn, file UploadPart, args UploadFileParams) (",
+		"func uploadImage(ctx context.Context, request RequestHandlerFn, content io.Reader, args UploadImageParams) (",
+	)
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		fmt.Println(r.Method, r.URL.Path, mediaType)
+		if mediaType == "multipart/form-data" {
+			r.ParseMultipartForm(1 << 20)
+			file, header, _ := r.FormFile("image")
+			content, _ := ioutil.ReadAll(file)
+			fmt.Println(r.FormValue("description"), header.Filename, string(content))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		fmt.Println(string(content))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	file := UploadPart{FieldName: "image", FileName: "cat.png", Content: strings.NewReader("meow")}
+	if _, err := uploadFile(context.Background(), handler, file, UploadFileParams{Description: "a cat"}); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := uploadImage(context.Background(), handler, strings.NewReader("purr"), UploadImageParams{ID: "1"}); err != nil {
+		fmt.Println(err)
+	}
+}`)
+	want := "POST /files multipart/form-data\na cat cat.png meow\nPUT /images/1 application/octet-stream\npurr\n"
+	if output != want {
+		t.Errorf("the generated uploads printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderRawAndTextResponses(t *testing.T) {
+	download := parseTestMethod(t, "http://example.com/images/{id}/file", `
+<method name="GET" id="downloadImage">
+  <request>
+    <param name="id" style="template" type="xsd:string"/>
+  </request>
+  <response status="200">
+    <representation mediaType="application/octet-stream"/>
+  </response>
+</method>`)
+	console := parseTestMethod(t, "http://example.com/console", `
+<method name="GET" id="getConsole">
+  <response status="200">
+    <representation mediaType="text/plain"/>
+  </response>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, download, console)
+	checkContains(t, client,
+		"func downloadImage(ctx context.Context, request RequestHandlerFn, args DownloadImageParams) (*RawResponse, error) {",
+		"func getConsole(ctx context.Context, request RequestHandlerFn, args GetConsoleParams) (*TextResponse, error) {",
+	)
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/console" {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "login:")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte{0, 1, 2})
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	raw, err := downloadImage(context.Background(), handler, DownloadImageParams{ID: "1"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	content, _ := ioutil.ReadAll(raw.Body)
+	raw.Body.Close()
+	fmt.Println(raw.StatusCode, raw.ContentType, raw.ContentLength, content)
+
+	text, err := getConsole(context.Background(), handler, GetConsoleParams{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(text.StatusCode, text.ContentType, text.Text)
+}`)
+	want := "200 application/octet-stream 3 [0 1 2]\n200 text/plain login:\n"
+	if output != want {
+		t.Errorf("the generated responses printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderContentNegotiation(t *testing.T) {
+	method := parseTestMethod(t, "http://example.com/servers/count", `
+<method name="GET" id="countServers">
+  <response status="200">
+    <representation mediaType="application/xml"/>
+    <representation mediaType="application/json"/>
+    <param name="count" style="plain" type="xsd:int"/>
+  </response>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		// JSON is asked for first, as what the results are built from.
+		`req.Header.Set("Accept", acceptHeader(ctx, "application/json, application/xml"))`,
+		"Count int `json:\"count,omitempty\" xml:\"count,omitempty\"`",
+	)
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept")
+		fmt.Println(accept)
+		switch {
+		case r.URL.Query().Get("broken") != "":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "{\"count\":")
+		case strings.HasPrefix(accept, "application/xml"):
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			io.WriteString(w, "<servers><count>2</count></servers>")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "{\"count\": 3}")
+		}
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	for _, ctx := range []context.Context{
+		context.Background(),
+		WithPreferredMediaType(context.Background(), "application/xml"),
+	} {
+		results, err := countServers(ctx, handler, CountServersParams{})
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(results.Count)
+	}
+
+	broken := func(req *http.Request) (*http.Response, error) {
+		req.URL.RawQuery = "broken=1"
+		return handler(req)
+	}
+	_, err := countServers(context.Background(), broken, CountServersParams{})
+	fmt.Println(err)
+}`)
+	want := "application/json, application/xml\n3\napplication/xml\n2\n" +
+		"application/json, application/xml\ncould not decode the response: unexpected end of JSON input\n"
+	if output != want {
+		t.Errorf("the generated negotiation printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderJSONBody(t *testing.T) {
+	method := parseTestMethod(t, "http://example.com/servers", `
+<method name="POST" id="createServer">
+  <request>
+    <param name="dry_run" style="query" type="xsd:boolean"/>
+    <representation mediaType="application/json">
+      <param name="name" style="plain" type="xsd:string" required="true"/>
+      <param name="min_count" style="plain" type="xsd:int"/>
+      <param name="description" style="plain" type="xsd:string"/>
+    </representation>
+  </request>
+  <response status="202"/>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client, "type CreateServerRequestBody struct {")
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Println(r.URL.RawQuery, r.Header.Get("Content-Type"), string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	dryRun := true
+	args := CreateServerParams{DryRun: &dryRun, Name: "web", MinCount: 2}
+	if _, err := createServer(context.Background(), handler, args); err != nil {
+		fmt.Println(err)
+	}
+}`)
+	// Only the plain params are in the body, and unset optional ones
+	// are left out of it.
+	if want := "dry_run=true application/json {\"name\":\"web\",\"min_count\":2}\n"; output != want {
+		t.Errorf("the generated request printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderTemplateParams(t *testing.T) {
+	method := parseTestMethod(t, "http://example.com/zones/{zone}/records/{id}/{enabled}/{since}", `
+<method name="GET" id="getRecord">
+  <request>
+    <param name="zone" style="template" type="xsd:string"/>
+    <param name="id" style="template" type="xsd:long"/>
+    <param name="enabled" style="template" type="xsd:boolean"/>
+    <param name="since" style="template" type="xsd:dateTime"/>
+  </request>
+  <response status="200"/>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println(r.RequestURI)
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	args := GetRecordParams{
+		Zone:    "example.com/internal zone",
+		ID:      -42,
+		Enabled: true,
+		Since:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if _, err := getRecord(context.Background(), handler, args); err != nil {
+		fmt.Println(err)
+	}
+}`)
+	if want := "/zones/example.com%2Finternal%20zone/records/-42/true/2020-01-02T03:04:05Z\n"; output != want {
+		t.Errorf("the generated request printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderOptionalPointers(t *testing.T) {
+	optionalPointers = true
+	defer func() { optionalPointers = false }()
+
+	method := parseTestMethod(t, "http://example.com/servers/{id}/logs", `
+<method name="GET" id="getLogs">
+  <request>
+    <param name="id" style="template" type="xsd:string"/>
+    <param name="name" style="query" type="xsd:string" required="true"/>
+    <param name="offset" style="query" type="xsd:int"/>
+    <param name="length" style="query" type="xsd:unsignedInt"/>
+  </request>
+  <response status="200"/>
+</method>`)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	checkContains(t, client,
+		"ID string",
+		"Name string",
+		"Offset *int",
+		"Length *uint32",
+		"func Int32(v int32) *int32 { return &v }",
+		"func Uint(v uint) *uint { return &v }",
+	)
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println(r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	for _, args := range []GetLogsParams{
+		{ID: "1", Name: "boot"},
+		{ID: "1", Name: "boot", Offset: Int(0), Length: Uint32(10)},
+	} {
+		if _, err := getLogs(context.Background(), handler, args); err != nil {
+			fmt.Println(err)
+		}
+	}
+}`)
+	// Zero values which are set are sent, unlike unset ones.
+	if want := "name=boot\nlength=10&name=boot&offset=0\n"; output != want {
+		t.Errorf("the generated requests printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+// parseTestSchema builds the grammar types defined by schemaJSON, a
+// JSON schema file, with their references resolved.
+func parseTestSchema(t *testing.T, schemaJSON string) []*WadlVariable {
+	t.Helper()
+	var rawSchema map[string]interface{}
+	if err := json.Unmarshal([]byte(schemaJSON), &rawSchema); err != nil {
+		t.Fatalf("could not parse %s: %v", schemaJSON, err)
+	}
+	grammarTypes := rawJsonSchemaParamToParam(rawSchema)
+	resolveJsonSchemaRefs(grammarTypes, grammarTypes, make(map[*WadlVariable]bool))
+	return grammarTypes
+}
+
+func TestRenderNestedSchemaTypes(t *testing.T) {
+	grammarTypes := parseTestSchema(t, `{
+  "properties": {
+    "node": {
+      "id": "http://example.com/schema#node",
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "parent": {"$ref": "http://example.com/schema#node"},
+        "children": {"type": "array", "items": {"$ref": "http://example.com/schema#node"}},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    }
+  }
+}`)
+	method := parseTestMethod(t, "http://example.com/nodes", `
+<method name="POST" id="createNode">
+  <request>
+    <representation mediaType="application/json"/>
+  </request>
+  <response status="201"/>
+</method>`)
+	method.Arguments = append(method.Arguments, grammarVariables(grammarTypes, "http://example.com/schema#node")...)
+	client := renderTestClient(t, RenderMethodWithBulkTypes, method)
+	// The node refers to itself through a pointer, and its children and
+	// labels are typed rather than left as interface{}.
+	checkContains(t, client,
+		"type Node struct {",
+		"Parent *Node",
+		"Children []Node",
+		"Labels map[string]string",
+		"Node Node",
+	)
+
+	output := runTestProgram(t, client, `package client
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Println(string(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	handler := func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+	args := CreateNodeParams{Node: Node{
+		Name:     "root",
+		Children: []Node{{Name: "leaf", Labels: map[string]string{"tier": "web"}}},
+	}}
+	if _, err := createNode(context.Background(), handler, args); err != nil {
+		fmt.Println(err)
+	}
+}`)
+	if want := `{"node":{"children":[{"labels":{"tier":"web"},"name":"leaf"}],"name":"root"}}` + "\n"; output != want {
+		t.Errorf("the generated request printed\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestRenderSharedSchemaTypes(t *testing.T) {
+	grammarTypes := parseTestSchema(t, `{
+  "properties": {
+    "server": {
+      "id": "http://example.com/schema#server",
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "metadata": {"type": "object", "properties": {"owner": {"type": "string"}}}
+      }
+    }
+  }
+}`)
+	var methods []*WadlMethod
+	for _, id := range []string{"createServer", "updateServer"} {
+		method := parseTestMethod(t, "http://example.com/servers", `
+<method name="POST" id="`+id+`">
+  <request>
+    <representation mediaType="application/json"/>
+  </request>
+  <response status="200"/>
+</method>`)
+		method.Arguments = append(method.Arguments, grammarVariables(grammarTypes, "http://example.com/schema#server")...)
+		methods = append(methods, method)
+	}
+	client := renderTestClient(t, RenderMethodWithBulkTypes, methods...)
+	// Both methods' params reference the one type, named after the
+	// schema rather than the first method to use it.
+	for _, decl := range []string{"type Server struct {", "type ServerMetadata struct {", "func (v Server) Validate() error"} {
+		if n := strings.Count(client, decl); n != 1 {
+			t.Errorf("%q is declared %d times, want once in\n%s", decl, n, client)
+		}
+	}
+	checkContains(t, client,
+		"type CreateServerParams struct {",
+		"type UpdateServerParams struct {",
+		"Server Server",
+		"Metadata ServerMetadata",
+	)
+	if strings.Contains(client, "CreateServerParamsServer") {
+		t.Errorf("the shared type is named after a method in\n%s", client)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// typeMappings maps type QNames to the Go types which represent them.
+// Go types from other packages are given by their import path, e.g.
+// github.com/google/uuid.UUID. These take precedence over the built-in
+// XML Schema and JSON Schema mappings.
+var typeMappings = map[string]string{
+	"csapi:uuid":   "string",
+	"csapi:string": "string",
+}
+
+// userTypeMappings are the type mappings read from the type map file,
+// which replace any of typeMappings for the same type.
+var userTypeMappings = make(map[string]string)
+
+// resolvedTypeMappings are the type mappings in effect, keyed by the
+// resolved QNames of their types, e.g.
+// {http://docs.openstack.org/compute/api/v1.1}uuid.
+var resolvedTypeMappings = make(map[string]string)
+
+// usedImports are the import paths, and the names they're imported
+// under, of the mapped types rendered so far.
+var usedImports = make(map[string]string)
+
+// readTypeMapFile reads userTypeMappings from the given JSON file. The
+// file is a single object whose keys are type QNames, either prefixed
+// (csapi:uuid) or namespaced
+// ({http://docs.openstack.org/compute/api/v1.1}uuid), and whose values
+// are Go types.
+func readTypeMapFile(filePath string) error {
+	body, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, &userTypeMappings); err != nil {
+		return fmt.Errorf("could not parse type map %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// resolveTypeMappings resolves the QNames of typeMappings and
+// userTypeMappings into resolvedTypeMappings. Prefixes are resolved
+// through the WADL's declarations, so this must be done once it has
+// been read.
+func resolveTypeMappings() error {
+	resolvedTypeMappings = make(map[string]string)
+	for _, mappings := range []map[string]string{typeMappings, userTypeMappings} {
+		// Only a mapping from the type map file replaces another; two
+		// from the same source are ambiguous.
+		resolvedBy := make(map[string]string)
+		for qname, goTypeRef := range mappings {
+			resolved := resolveMappedQName(qname)
+			if other, ok := resolvedBy[resolved]; ok && mappings[other] != goTypeRef {
+				first, second := other, qname
+				if second < first {
+					first, second = second, first
+				}
+				return fmt.Errorf("type mappings for %s and %s are both for %s", first, second, resolved)
+			}
+			resolvedBy[resolved] = qname
+			resolvedTypeMappings[resolved] = goTypeRef
+		}
+	}
+
+	// Packages are imported under the last element of their path, so
+	// two packages with the same one can't both be.
+	var goTypeRefs []string
+	for _, goTypeRef := range resolvedTypeMappings {
+		goTypeRefs = append(goTypeRefs, goTypeRef)
+	}
+	sort.Strings(goTypeRefs)
+	importPaths := make(map[string]string)
+	for _, goTypeRef := range goTypeRefs {
+		_, importPath, importName := parseGoTypeRef(goTypeRef)
+		if importPath == "" {
+			continue
+		}
+		if other, ok := importPaths[importName]; ok && other != importPath {
+			return fmt.Errorf("the mapped types of %s and %s would both be imported as %s", other, importPath, importName)
+		}
+		importPaths[importName] = importPath
+	}
+	return nil
+}
+
+// resolveMappedQName resolves the QName of a mapped type to the form
+// its key in resolvedTypeMappings takes. Prefixes which aren't
+// well-known are resolved through the WADL's declarations.
+func resolveMappedQName(qname string) string {
+	namespace, local := splitQName(qname)
+	if strings.Contains(qname, ":") && !strings.HasPrefix(qname, "{") {
+		if documentNamespace, ok := documentNamespaces[namespace]; ok {
+			namespace = documentNamespace
+		}
+	}
+	return renderQName(namespace, local)
+}
+
+// lookupTypeMapping returns the Go type mapped to the given type QName,
+// noting any import it requires.
+func lookupTypeMapping(wadlType string) (string, bool) {
+	goTypeRef, ok := resolvedTypeMappings[renderQName(splitQName(wadlType))]
+	if !ok {
+		return "", false
+	}
+
+	goType, importPath, importName := parseGoTypeRef(goTypeRef)
+	if importPath != "" {
+		usedImports[importPath] = importName
+	}
+	return goType, true
+}
+
+// parseGoTypeRef splits a reference to a Go type, such as
+// []github.com/google/uuid.UUID, into how the type is written in the
+// generated code and the import it requires, if any.
+func parseGoTypeRef(ref string) (goType, importPath, importName string) {
+	var modifiers string
+	for _, modifier := range []string{"[]", "*"} {
+		for strings.HasPrefix(ref, modifier) {
+			modifiers += modifier
+			ref = ref[len(modifier):]
+		}
+	}
+
+	pkgStart := strings.LastIndex(ref, "/") + 1
+	dotIdx := strings.Index(ref[pkgStart:], ".")
+	if dotIdx < 0 {
+		return modifiers + ref, "", ""
+	}
+	importPath = ref[:pkgStart+dotIdx]
+	importName = renderPackageName(importPath)
+	return modifiers + importName + "." + ref[pkgStart+dotIdx+1:], importPath, importName
+}
+
+// renderPackageName guesses the name a package is imported under from
+// the last element of its path, dropping anything which can't appear
+// in an identifier.
+func renderPackageName(importPath string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, path.Base(importPath))
+}
+
+// renderImports renders an import declaration for the packages of the
+// mapped types in imports, which maps import paths to names.
+func renderImports(writer io.Writer, imports map[string]string) {
+	if len(imports) <= 0 {
+		return
+	}
+
+	var importPaths []string
+	for importPath := range imports {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+
+	fmt.Fprint(writer, "\n\nimport (")
+	for _, importPath := range importPaths {
+		if importName := imports[importPath]; importName != path.Base(importPath) {
+			fmt.Fprintf(writer, "\n\t%s %q", importName, importPath)
+			continue
+		}
+		fmt.Fprintf(writer, "\n\t%q", importPath)
+	}
+	fmt.Fprint(writer, "\n)")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveTypeMappings(t *testing.T) {
+	documentNamespaces = map[string]string{"csapi": "urn:csapi"}
+	defer func() {
+		documentNamespaces = make(map[string]string)
+		userTypeMappings = make(map[string]string)
+	}()
+
+	tests := []struct {
+		name     string
+		mappings string
+		lookups  map[string]string
+		err      string
+	}{{
+		name:     "built-in",
+		mappings: `{}`,
+		lookups:  map[string]string{"{urn:csapi}uuid": "string"},
+	}, {
+		name:     "replacing a built-in",
+		mappings: `{"csapi:uuid": "github.com/google/uuid.UUID"}`,
+		lookups: map[string]string{
+			"{urn:csapi}uuid": "uuid.UUID",
+			// Matching is case-sensitive.
+			"{urn:csapi}UUID": "",
+		},
+	}, {
+		name:     "namespaced",
+		mappings: `{"{urn:other}ids": "[]github.com/google/uuid.UUID"}`,
+		lookups:  map[string]string{"{urn:other}ids": "[]uuid.UUID"},
+	}, {
+		name:     "two mappings for one type",
+		mappings: `{"csapi:uuid": "string", "{urn:csapi}uuid": "github.com/google/uuid.UUID"}`,
+		err:      "type mappings for csapi:uuid and {urn:csapi}uuid are both for {urn:csapi}uuid",
+	}, {
+		name:     "packages with the same name",
+		mappings: `{"csapi:a": "github.com/google/uuid.UUID", "csapi:b": "example.com/uuid.UUID"}`,
+		err:      "the mapped types of example.com/uuid and github.com/google/uuid would both be imported as uuid",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "types.json")
+			if err := ioutil.WriteFile(filePath, []byte(test.mappings), 0644); err != nil {
+				t.Fatal(err)
+			}
+			userTypeMappings = make(map[string]string)
+			if err := readTypeMapFile(filePath); err != nil {
+				t.Fatalf("readTypeMapFile failed: %v", err)
+			}
+
+			err := resolveTypeMappings()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("resolveTypeMappings() = %v, want %q", err, test.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("resolveTypeMappings() failed: %v", err)
+			}
+			for wadlType, want := range test.lookups {
+				if got, _ := lookupTypeMapping(wadlType); got != want {
+					t.Errorf("lookupTypeMapping(%q) = %q, want %q", wadlType, got, want)
+				}
+			}
+		})
+	}
+}
@@ -287,7 +287,7 @@ type XsdGoPkgHasAttr_MediaType_XsdtString_ struct {
 }
 
 type XsdGoPkgHasAttr_Value_XsdtString_ struct {
-	Value xsdt.String `xml:"http://wadl.dev.java.net/2009/02 value,attr"`
+	Value xsdt.String `xml:"value,attr"`
 }
 
 type TxsdOption struct {
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const (
+	xmlSchemaNamespace = "http://www.w3.org/2001/XMLSchema"
+	wadlNamespace      = "http://wadl.dev.java.net/2009/02"
+	xmlNamespace       = "http://www.w3.org/XML/1998/namespace"
+	// xsdxtNamespace is that of the Rackspace extensions to WADL, whose
+	// code element holds examples.
+	xsdxtNamespace = "http://docs.rackspacecloud.com/xsd-ext/v1.0"
+)
+
+// xmlNamespaces maps the well-known prefixes used in type QNames to the
+// namespaces they're bound to, which WADLs often use without declaring.
+var xmlNamespaces = map[string]string{
+	"xsd": xmlSchemaNamespace,
+	"xs":  xmlSchemaNamespace,
+}
+
+// documentNamespaces maps the prefixes declared in the WADL document to
+// the first namespace each is bound to, for the type QNames of other
+// sources, such as the type map, which have no declarations of their
+// own. QNames within the document only ever use the declarations in
+// scope.
+var documentNamespaces = make(map[string]string)
+
+// xsdBuiltinTypes maps the local names of XML Schema's built-in types,
+// lower-cased, to the Go types which represent them.
+var xsdBuiltinTypes = map[string]string{
+	"anytype":       "interface{}",
+	"anysimpletype": "interface{}",
+
+	"string":           "string",
+	"normalizedstring": "string",
+	"token":            "string",
+	"language":         "string",
+	"name":             "string",
+	"ncname":           "string",
+	"nmtoken":          "string",
+	"id":               "string",
+	"idref":            "string",
+	"entity":           "string",
+	"anyuri":           "string",
+	"qname":            "string",
+	"notation":         "string",
+	"nmtokens":         "[]string",
+	"idrefs":           "[]string",
+	"entities":         "[]string",
+
+	"boolean": "bool",
+
+	"decimal": "float64",
+	"float":   "float32",
+	"double":  "float64",
+
+	"integer":            "int64",
+	"nonpositiveinteger": "int64",
+	"negativeinteger":    "int64",
+	"long":               "int64",
+	"int":                "int",
+	"short":              "int16",
+	"byte":               "int8",
+	"nonnegativeinteger": "uint64",
+	"positiveinteger":    "uint64",
+	"unsignedlong":       "uint64",
+	"unsignedint":        "uint32",
+	"unsignedshort":      "uint16",
+	"unsignedbyte":       "uint8",
+
+	"datetime": "time.Time",
+	// Neither time.Time nor time.Duration can parse the lexical forms of
+	// these, so they're left for the caller to interpret.
+	"date":       "string",
+	"time":       "string",
+	"duration":   "string",
+	"gyear":      "string",
+	"gyearmonth": "string",
+	"gmonth":     "string",
+	"gmonthday":  "string",
+	"gday":       "string",
+
+	// base64Binary is what encoding/json does with []byte anyway.
+	"base64binary": "[]byte",
+	"hexbinary":    "string",
+
+	// These aren't XML Schema built-ins, but OpenStack WADLs use them
+	// as if they were.
+	"dict": "interface{}",
+	"uuid": "string",
+}
+
+// jsonSchemaTypes maps JSON Schema's primitive types to Go types.
+var jsonSchemaTypes = map[string]string{
+	"string":  "string",
+	"integer": "int",
+	"number":  "float64",
+	"boolean": "bool",
+	// Objects with properties, and arrays or dictionaries of them, are
+	// given generated types instead. These are for free-form values.
+	"object": "interface{}",
+	"array":  "[]interface{}",
+}
+
+// splitQName splits a type's QName into its namespace and local name.
+// Both prefixed names, e.g. xsd:string, and names already resolved to
+// their namespace, e.g. {http://www.w3.org/2001/XMLSchema}string, are
+// understood. Names without a prefix have no namespace.
+func splitQName(qname string) (namespace, local string) {
+	if strings.HasPrefix(qname, "{") {
+		if end := strings.Index(qname, "}"); end > 0 {
+			return qname[1:end], qname[end+1:]
+		}
+	}
+
+	prefixIdx := strings.Index(qname, ":")
+	if prefixIdx < 0 {
+		return "", qname
+	}
+	prefix := qname[:prefixIdx]
+	if namespace, ok := xmlNamespaces[prefix]; ok {
+		return namespace, qname[prefixIdx+1:]
+	}
+	// Leave the prefix in place of the namespace it stands for.
+	return prefix, qname[prefixIdx+1:]
+}
+
+// renderQName renders a QName in the form resolveQNames gives it, i.e.
+// {namespace}local, or just local if it has no namespace.
+func renderQName(namespace, local string) string {
+	if namespace == "" {
+		return local
+	}
+	return "{" + namespace + "}" + local
+}
+
+// resolveQNames rewrites a WADL document so that the QNames of param
+// types are resolved through the namespace declarations in scope. For example, with xmlns:xs bound to XML
+// Schema, type="xs:string" becomes
+// type="{http://www.w3.org/2001/XMLSchema}string". Everything else is
+// left byte-for-byte as it was, so that inner XML can still be read.
+func resolveQNames(doc []byte) ([]byte, error) {
+	var resolved bytes.Buffer
+	var resolver qnameResolver
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tokenStart := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rawToken := doc[tokenStart:decoder.InputOffset()]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			resolver.pushScope(t.Attr)
+			if t.Name.Local == "param" {
+				rawToken = resolver.resolveAttr(rawToken, "type")
+			}
+		case xml.EndElement:
+			resolver.popScope()
+		}
+		resolved.Write(rawToken)
+	}
+	return resolved.Bytes(), nil
+}
+
+// qnameResolver tracks the namespace declarations in scope while
+// reading an XML document.
+type qnameResolver struct {
+	scopes []map[string]string
+}
+
+func (r *qnameResolver) pushScope(attrs []xml.Attr) {
+	scope := make(map[string]string)
+	for _, attr := range attrs {
+		switch {
+		case attr.Name.Space == "xmlns":
+			scope[attr.Name.Local] = attr.Value
+			if _, ok := documentNamespaces[attr.Name.Local]; !ok {
+				documentNamespaces[attr.Name.Local] = attr.Value
+			}
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			scope[""] = attr.Value
+		}
+	}
+	r.scopes = append(r.scopes, scope)
+}
+
+func (r *qnameResolver) popScope() {
+	if len(r.scopes) > 0 {
+		r.scopes = r.scopes[:len(r.scopes)-1]
+	}
+}
+
+// resolveAttr resolves the QName in the value of the named, unprefixed
+// attribute of the raw start element.
+func (r *qnameResolver) resolveAttr(rawElem []byte, attrName string) []byte {
+	attrPattern := regexp.MustCompile(`(\s` + attrName + `\s*=\s*)("[^"]*"|'[^']*')`)
+	return attrPattern.ReplaceAllFunc(rawElem, func(attr []byte) []byte {
+		match := attrPattern.FindSubmatch(attr)
+		quote, qname := match[2][:1], string(match[2][1:len(match[2])-1])
+		if qname == "" {
+			return attr
+		}
+		return []byte(string(match[1]) + string(quote) + r.resolve(qname) + string(quote))
+	})
+}
+
+// resolve renders qname as {namespace}local using the innermost
+// declaration of its prefix. QNames with prefixes which are neither
+// declared nor well-known are left as they are.
+func (r *qnameResolver) resolve(qname string) string {
+	if strings.HasPrefix(qname, "{") {
+		return qname
+	}
+
+	var prefix, local string
+	if prefixIdx := strings.Index(qname, ":"); prefixIdx >= 0 {
+		prefix, local = qname[:prefixIdx], qname[prefixIdx+1:]
+	} else {
+		local = qname
+	}
+	if prefix == "xml" {
+		return renderQName(xmlNamespace, local)
+	}
+
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if namespace, ok := r.scopes[i][prefix]; ok {
+			// An empty namespace undeclares the default one.
+			return renderQName(namespace, local)
+		}
+	}
+	// Fall back on the well-known prefixes, which WADLs often use
+	// without declaring.
+	if namespace, ok := xmlNamespaces[prefix]; ok {
+		return renderQName(namespace, local)
+	}
+	if prefix != "" {
+		log.Printf("WARNING: no namespace declared for the prefix of %s", qname)
+	}
+	return qname
+}
@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestResolveQNames(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{{
+		name: "declared prefix",
+		doc:  `<resource xmlns:x="urn:A"><param type="x:foo"/></resource>`,
+		want: `<resource xmlns:x="urn:A"><param type="{urn:A}foo"/></resource>`,
+	}, {
+		name: "well-known prefix",
+		doc:  `<resource><param type="xsd:string"/></resource>`,
+		want: `<resource><param type="{http://www.w3.org/2001/XMLSchema}string"/></resource>`,
+	}, {
+		name: "default namespace",
+		doc:  `<resource xmlns="urn:D"><param type="foo"/></resource>`,
+		want: `<resource xmlns="urn:D"><param type="{urn:D}foo"/></resource>`,
+	}, {
+		name: "inner declaration shadows outer",
+		doc:  `<a xmlns:x="urn:A"><b xmlns:x="urn:B"><param type="x:foo"/></b><param type="x:foo"/></a>`,
+		want: `<a xmlns:x="urn:A"><b xmlns:x="urn:B"><param type="{urn:B}foo"/></b><param type="{urn:A}foo"/></a>`,
+	}, {
+		name: "self-closing siblings keep their parent's scope",
+		doc:  `<app><resource xmlns:x="urn:A"><param type="x:foo"/></resource><resource xmlns:x="urn:B"><param type="x:foo"/><param type="x:foo"/></resource></app>`,
+		want: `<app><resource xmlns:x="urn:A"><param type="{urn:A}foo"/></resource><resource xmlns:x="urn:B"><param type="{urn:B}foo"/><param type="{urn:B}foo"/></resource></app>`,
+	}, {
+		name: "declarations out of scope are not used",
+		doc:  `<app><resource xmlns:x="urn:A"/><param type="x:foo"/></app>`,
+		want: `<app><resource xmlns:x="urn:A"/><param type="x:foo"/></app>`,
+	}, {
+		name: "representation element untouched",
+		doc:  `<representation xmlns:x="urn:A" element='x:server' mediaType="application/xml"/>`,
+		want: `<representation xmlns:x="urn:A" element='x:server' mediaType="application/xml"/>`,
+	}, {
+		name: "already resolved",
+		doc:  `<param type="{urn:A}foo"/>`,
+		want: `<param type="{urn:A}foo"/>`,
+	}, {
+		name: "other attributes and elements untouched",
+		doc:  `<doc type="x:foo">a &amp; b<![CDATA[<param type="x:foo"/>]]></doc><param name="x:y" type="xml:lang"/>`,
+		want: `<doc type="x:foo">a &amp; b<![CDATA[<param type="x:foo"/>]]></doc><param name="x:y" type="{http://www.w3.org/XML/1998/namespace}lang"/>`,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveQNames([]byte(test.doc))
+			if err != nil {
+				t.Fatalf("resolveQNames(%q) failed: %v", test.doc, err)
+			}
+			if string(got) != test.want {
+				t.Errorf("resolveQNames(%q)\n got %s\nwant %s", test.doc, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderType(t *testing.T) {
+	if err := resolveTypeMappings(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		wadlType string
+		want     string
+	}{
+		{"{http://www.w3.org/2001/XMLSchema}string", "string"},
+		{"{http://www.w3.org/2001/XMLSchema}dateTime", "time.Time"},
+		{"{http://www.w3.org/2001/XMLSchema}date", "string"},
+		{"{http://www.w3.org/2001/XMLSchema}unsignedShort", "uint16"},
+		{"{http://www.w3.org/2001/XMLSchema}positiveInteger", "uint64"},
+		{"{http://www.w3.org/2001/XMLSchema}decimal", "float64"},
+		{"{http://www.w3.org/2001/XMLSchema}base64Binary", "[]byte"},
+		{"{http://www.w3.org/2001/XMLSchema}NMTOKENS", "[]string"},
+		{"{http://www.w3.org/2001/XMLSchema}anyType", "interface{}"},
+		{"xsd:boolean", "bool"},
+		{"xs:long", "int64"},
+		{"integer", "int"},
+		{"number", "float64"},
+		{"{http://wadl.dev.java.net/2009/02}string", "string"},
+	}
+	for _, test := range tests {
+		if got := renderType(test.wadlType); got != test.want {
+			t.Errorf("renderType(%q) = %q, want %q", test.wadlType, got, test.want)
+		}
+	}
+}